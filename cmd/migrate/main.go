@@ -0,0 +1,32 @@
+// Command migrate rolls back the schema of the game database. Upgrades need
+// no command: the server applies new migrations when it starts.
+//
+//	go run ./cmd/migrate -to 1
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	_ "github.com/joho/godotenv/autoload"
+
+	"prisoner-fencing/internal/database"
+)
+
+func main() {
+	url := flag.String("db", os.Getenv("BLUEPRINT_DB_URL"), "database to migrate")
+	target := flag.Int("to", -1, "schema version to migrate down to, 0 removes every table")
+	flag.Parse()
+
+	if *url == "" || *target < 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	from, err := database.MigrateDown(*url, *target)
+	if err != nil {
+		log.Fatalf("Failed to migrate down: %v", err)
+	}
+	log.Printf("Migrated %s down from version %d to %d", *url, from, *target)
+}
@@ -0,0 +1,29 @@
+import { send } from './ws';
+
+// Action waiting to be revealed in a commit-reveal room
+let pending: { room: string; action: string; nonce: string } | null = null;
+
+async function sha256Hex(text: string): Promise<string> {
+	const digest = await crypto.subtle.digest('SHA-256', new TextEncoder().encode(text));
+	return Array.from(new Uint8Array(digest), (b) => b.toString(16).padStart(2, '0')).join('');
+}
+
+/**
+ * Send a commitment to an action without revealing it
+ * @param {string} room
+ * @param {string} action
+ */
+export const commitAction = async (room: string, action: string) => {
+	const nonce = Array.from(crypto.getRandomValues(new Uint8Array(16)), (b) => b.toString(16).padStart(2, '0')).join('');
+	pending = { room, action, nonce };
+	send('game_commit', { room, commitment: await sha256Hex(`${action}:${nonce}`) });
+};
+
+/**
+ * Reveal the committed action once both players have committed
+ */
+export const revealAction = () => {
+	if (!pending) return;
+	send('game_reveal', pending);
+	pending = null;
+};
@@ -15,8 +15,17 @@ export const EVENT = {
 export const LOBBY_EVENT = {
     listRooms: 'list_rooms',
     joinRoom: 'join_room',
+    leaveRoom: 'leave_room',
     error: 'error',
     chat: 'new_message',
     initClient: 'init_client',
+    queueJoin: 'queue_join',
+    queueLeave: 'queue_leave',
+    matchFound: 'match_found',
+    matchCancelled: 'match_cancelled',
+    roomClosed: 'room_closed',
+    tournamentWatch: 'tournament_watch',
+    tournamentUpdate: 'tournament_update',
+    tournamentMatch: 'tournament_match',
 } as const;
 
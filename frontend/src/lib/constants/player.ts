@@ -1,12 +1,12 @@
-let _playerId: string | undefined = undefined;
+// The session token the server issued us is kept in localStorage, so a
+// player who reloads or loses their connection is the same player again and
+// gets their seat back. The player id itself comes from the server.
+const TOKEN_KEY = 'sessionToken';
 
-function generatePlayerId() {
-    return Math.random().toString(36).substring(2, 15);
+export function getSessionToken(): string {
+    return localStorage.getItem(TOKEN_KEY) ?? '';
 }
 
-export const PLAYER_ID = (() => {
-    if (!_playerId) {
-        _playerId = generatePlayerId();
-    }
-    return _playerId;
-})();
\ No newline at end of file
+export function setSessionToken(token: string) {
+    localStorage.setItem(TOKEN_KEY, token);
+}
@@ -1,7 +1,10 @@
 import { LOBBY_EVENT as EVENT } from '../constants/events';
 import { gameState } from './gameState.svelte';
+import { useState } from './state.svelte';
+import { revealAction } from '../commit';
 
 const gs = gameState();
+const states = useState();
 
 export function gameMessageHandler(msg: any) {
     console.log('Received game message:', msg);
@@ -10,17 +13,40 @@ export function gameMessageHandler(msg: any) {
     switch (msg.type) {
         case EVENT.error:
             console.log('lobbyerror', msg);
+            states.error = msg.payload.message;
             break;
         case 'GAME_ACTION_RESULT':
             if (payload.turn !== undefined) gs.turn = payload.turn;
             if (payload.maxTurns !== undefined) gs.maxTurns = payload.maxTurns;
+            if (payload.ruleset?.boardWidth !== undefined) gs.boardWidth = payload.ruleset.boardWidth;
             if (payload.lastAction !== undefined) gs.lastAction = payload.lastAction;
             if (payload.gameOver !== undefined) gs.gameOver = payload.gameOver;
             if (payload.winner !== undefined) gs.winner = payload.winner;
             if (payload.status !== undefined) gs.status = payload.status;
+            gs.deadline = payload.timeLeft ? Date.now() + payload.timeLeft : 0;
+            gs.commitReveal = !!payload.commitReveal;
+            gs.spectator = !!payload.spectator;
+            if (payload.spectators !== undefined) gs.spectators = payload.spectators;
+            gs.series = payload.series ?? null;
+            if (payload.spectator) {
+                if (payload.playerStates?.player1 !== undefined) gs.you = payload.playerStates.player1;
+                if (payload.playerStates?.player2 !== undefined) gs.opponent = payload.playerStates.player2;
+                break;
+            }
             if (payload.playerStates?.opponent !== undefined) gs.opponent = payload.playerStates.opponent;
             if (payload.playerStates?.you !== undefined) gs.you = payload.playerStates.you;
             break;
+        case 'SPECTATOR_COUNT':
+            gs.spectators = payload.spectators;
+            break;
+        case EVENT.leaveRoom:
+            states.currentRoom = '';
+            states.invite = '';
+            break;
+        case 'REVEAL_ACTIONS':
+            gs.status = payload.status;
+            revealAction();
+            break;
         case 'UPDATE_STATUS':
             gs.status = payload.status;
             break;
@@ -4,15 +4,25 @@ type PlayerState = {
 	action: string;
 	advanced: boolean;
 	player?: number;
+	name?: string;
 };
 
 let status = $state<string>('');
 let turn = $state<number>(0);
 let maxTurns = $state<number>(20);
+let boardWidth = $state<number>(7);
 let lastAction = $state<string>('');
 let gameOver = $state<boolean>(false);
 let winner = $state<string>('');
 let waitingForOpponent = $state<boolean>(false);
+// Time (ms since epoch) by which an action must be chosen, 0 without a turn timer
+let deadline = $state<number>(0);
+let commitReveal = $state<boolean>(false);
+// Watching rather than playing: "you" is player 1 and "opponent" player 2
+let spectator = $state<boolean>(false);
+let spectators = $state<number>(0);
+// Score of a best-of series, keyed like the player states; null for single games
+let series = $state<{ bestOf: number; game: number; wins: Record<string, number>; over: boolean } | null>(null);
 let opponent = $state<PlayerState>({
 	energy: 10, action: '', advanced: false
 });
@@ -28,6 +38,8 @@ export function gameState() {
 		set turn(value) { turn = value; },
 		get maxTurns() { return maxTurns; },
 		set maxTurns(value) { maxTurns = value; },
+		get boardWidth() { return boardWidth; },
+		set boardWidth(value) { boardWidth = value; },
 		get lastAction() { return lastAction; },
 		set lastAction(value) { lastAction = value; },
 		get gameOver() { return gameOver; },
@@ -36,6 +48,16 @@ export function gameState() {
 		set winner(value) { winner = value; },
 		get waitingForOpponent() { return waitingForOpponent; },
 		set waitingForOpponent(value) { waitingForOpponent = value; },
+		get deadline() { return deadline; },
+		set deadline(value) { deadline = value; },
+		get commitReveal() { return commitReveal; },
+		set commitReveal(value) { commitReveal = value; },
+		get spectator() { return spectator; },
+		set spectator(value) { spectator = value; },
+		get spectators() { return spectators; },
+		set spectators(value) { spectators = value; },
+		get series() { return series; },
+		set series(value) { series = value; },
 		get opponent() { return opponent; },
 		set opponent(value) { opponent = value; },
 		get you() { return you; },
@@ -1,5 +1,6 @@
 import { LOBBY_EVENT as EVENT } from '../constants/events';
 import { useState } from '../stores/state.svelte';
+import { send } from '../ws';
 
 const states = useState();
 
@@ -10,15 +11,41 @@ export function lobbyMessageHandler(msg: any) {
             break;
         case EVENT.joinRoom:
             states.currentRoom = msg.payload.room;
+            states.invite = msg.payload.invite ?? '';
             break;
-        case EVENT.chat:
-            console.log(`Message from room ${msg.room}: ${msg.payload}`);
+        case EVENT.queueJoin:
+        case EVENT.queueLeave:
+            states.queued = msg.payload.queued;
+            break;
+        case EVENT.matchFound:
+            states.queued = false;
+            send('join_room', { room: msg.payload.room });
+            break;
+        case EVENT.matchCancelled:
+            states.error = msg.payload.status;
+            send('leave_room', {});
+            break;
+        case EVENT.roomClosed:
+            // The server has already put us back in the lobby
+            states.error = msg.payload.status;
+            states.currentRoom = '';
+            states.invite = '';
             break;
-        case EVENT.initClient:
-            console.log('Client initialized:', msg.payload);
+        case EVENT.tournamentUpdate:
+            states.tournament = msg.payload;
+            break;
+        case EVENT.tournamentMatch:
+            // A drawn match is replayed in the room we are already in
+            if (states.currentRoom !== msg.payload.room) {
+                send('join_room', { room: msg.payload.room });
+            }
+            break;
+        case EVENT.chat:
+            console.log(`${msg.payload.name}: ${msg.payload.message}`);
             break;
         case EVENT.error:
             console.log('lobbyerror', msg);
+            states.error = msg.payload.message;
             break;
         default:
             console.log('unknown emit from server', msg);
@@ -1,8 +1,54 @@
 
-let rooms = $state<string[]>([]);
+// A room in the room list
+export interface RoomInfo {
+	name: string;
+	owner?: string;
+	ownerName?: string;
+	created: string;
+	ruleset: string;
+	bestOf: number;
+	visibility: 'public' | 'private' | 'invite';
+	seats: number;
+	players: number;
+	spectators: number;
+	status: 'waiting' | 'playing' | 'finished';
+}
+
+// A match of a tournament bracket
+export interface TournamentMatch {
+	id: number;
+	bracket: 'winners' | 'losers' | 'final' | 'rounds';
+	round: number;
+	players: [string, string];
+	winner?: string;
+	draw?: boolean;
+	done: boolean;
+	bye?: boolean;
+}
+
+// A tournament as sent in tournament_update
+export interface TournamentInfo {
+	id: string;
+	name: string;
+	format: 'single' | 'double' | 'swiss';
+	status: 'registering' | 'running' | 'finished';
+	entrants: { player: string; name: string; rating: number }[];
+	bracket?: { matches: TournamentMatch[]; champion?: string };
+	standings?: { player: string; points: number; wins: number; draws: number; losses: number }[];
+	rooms?: Record<string, string>;
+}
+
+let rooms = $state<RoomInfo[]>([]);
 let userState = $state('');
 let currentRoom = $state('');
+// Invite code of the current room, given to its owner
+let invite = $state('');
 let error = $state<string | undefined>('');
+let playerId = $state('');
+// Waiting in the matchmaking queue
+let queued = $state(false);
+// Tournament being watched
+let tournament = $state<TournamentInfo | undefined>();
 
 export function useState() {
 	return {
@@ -12,7 +58,15 @@ export function useState() {
 		set rooms(value) { rooms = value; },
 		get currentRoom() { return currentRoom; },
 		set currentRoom(value) { currentRoom = value; },
+		get invite() { return invite; },
+		set invite(value) { invite = value; },
 		get error() { return error; },
 		set error(value) { error = value; },
+		get playerId() { return playerId; },
+		set playerId(value) { playerId = value; },
+		get queued() { return queued; },
+		set queued(value) { queued = value; },
+		get tournament() { return tournament; },
+		set tournament(value) { tournament = value; },
 	};
 }
\ No newline at end of file
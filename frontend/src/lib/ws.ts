@@ -2,11 +2,21 @@
 import { useState } from './stores/state.svelte';
 import { gameMessageHandler } from './stores/gameMessageHandler';
 import { lobbyMessageHandler } from './stores/lobbyMessageHandler';
-import { PLAYER_ID } from './constants/player';
+import { getSessionToken, setSessionToken } from './constants/player';
 
 const states = useState();
 const decoder = new TextDecoder("utf-8");
 let ws: WebSocket;
+
+// Events handled by the game view; everything else goes to the lobby.
+const GAME_EVENTS = new Set(['GAME_ACTION_RESULT', 'UPDATE_STATUS', 'REVEAL_ACTIONS', 'SPECTATOR_COUNT', 'leave_room', 'ack']);
+
+// Events the server always answers directly, so send can wait for the reply.
+const REPLIED_EVENTS = new Set(['init_client', 'list_rooms', 'join_room', 'leave_room', 'game_action', 'game_commit', 'game_reveal', 'rematch', 'tournament_watch']);
+
+// Replies awaited by send, by the id of the event they answer.
+let nextId = 1;
+const pending = new Map<string, (msg: any) => void>();
 /**
  * Create a websocket connection
  * @param {string} socketURL
@@ -25,20 +35,27 @@ export const connect = (socketURL: string) => {
 	}
 	//ws.binaryType = 'arraybuffer';
 
-	ws.addEventListener('open', () => {
+	ws.addEventListener('open', async () => {
 		states.userState = 'connected';
-		ws.send(JSON.stringify({ type: "init_client", payload: { playerId: PLAYER_ID } }));
+		await initClient(socketURL);
 		// send("join_room", {
 		// 	"room": "default",
 		// 	"playerId": PLAYER_ID,
 		// });
-		ws.send(JSON.stringify({ type: "list_rooms" }));
+		send('list_rooms', {});
 	});
 
 	ws.addEventListener('message', ({ data }) => {
 		//const msg = data instanceof ArrayBuffer ? JSON.parse(decoder.decode(data)) : JSON.parse(data);
 		const msg = JSON.parse(data);
-		if (states.currentRoom) {
+		if (msg.id && pending.has(msg.id)) {
+			pending.get(msg.id)!(msg);
+			pending.delete(msg.id);
+		}
+		if (msg.type === 'init_client') {
+			states.playerId = msg.payload.playerId;
+			setSessionToken(msg.payload.token);
+		} else if (GAME_EVENTS.has(msg.type)) {
 			gameMessageHandler(msg);
 		} else {
 			lobbyMessageHandler(msg);
@@ -47,7 +64,11 @@ export const connect = (socketURL: string) => {
 
 	ws.addEventListener('close', (message) => {
 		console.log('Disconnected:', message);
-		//state.update((state) => ({ ...state, error: message }));
+		// Replies to anything sent on this connection will never come
+		pending.forEach((resolve) => resolve({ type: 'error', payload: { code: 'disconnected', message: 'Disconnected' } }));
+		pending.clear();
+		// Reconnect so the server can give us our seat back
+		setTimeout(() => connect(socketURL), 1000);
 	});
 
 	ws.addEventListener('error', (err) => {
@@ -56,12 +77,59 @@ export const connect = (socketURL: string) => {
 	});
 };
 
-export const send = (type: string, message: Record<string, unknown>): void => {
+/**
+ * Identify ourselves with our session token. An expired token is swapped for
+ * a fresh one, which only works for registered players; if that fails too we
+ * say so and start over as a new guest.
+ */
+async function initClient(socketURL: string) {
+	let reply = await send('init_client', { token: getSessionToken() });
+	if (reply.type === 'error' && reply.payload.code === 'session_expired') {
+		const token = await refreshSession(socketURL);
+		if (token) {
+			reply = await send('init_client', { token });
+		}
+	}
+	if (reply.type === 'error' && ['session_expired', 'invalid_session'].includes(reply.payload.code)) {
+		await send('init_client', { token: '' });
+		states.error = 'Your session could not be restored, you are playing as a new guest';
+	}
+}
+
+/**
+ * Swap our expired session token for a fresh one
+ * @returns the fresh token, or '' if the server would not refresh it
+ */
+async function refreshSession(socketURL: string): Promise<string> {
+	const url = socketURL.replace(/^ws/, 'http').replace(/\/ws$/, '/sessions/refresh');
+	try {
+		const resp = await fetch(url, { method: 'POST', headers: { Authorization: `Bearer ${getSessionToken()}` } });
+		if (!resp.ok) {
+			return '';
+		}
+		const session = await resp.json();
+		return session.token;
+	} catch {
+		return '';
+	}
+}
+
+/**
+ * Send an event to the server
+ * @returns the server's direct reply to it: the response, an ack or an error.
+ * Events without a direct reply resolve straight away.
+ */
+export const send = (type: string, message: Record<string, unknown>): Promise<any> => {
 	if (!ws || ws.readyState !== WebSocket.OPEN) {
 		console.error('WebSocket is not open.');
-		return;
+		return Promise.resolve({ type: 'error', payload: { code: 'disconnected', message: 'WebSocket is not open' } });
 	}
-	message = Object.assign({ type }, { payload: message });
+	const id = String(nextId++);
+	// Other events only get a reply when they fail, which the handlers see
+	const reply = REPLIED_EVENTS.has(type)
+		? new Promise<any>((resolve) => pending.set(id, resolve))
+		: Promise.resolve(undefined);
 
-	ws.send(JSON.stringify(message));
+	ws.send(JSON.stringify({ type, payload: message, id }));
+	return reply;
 };
@@ -6,4 +6,5 @@ require (
 	github.com/coder/websocket v1.8.13
 	github.com/joho/godotenv v1.5.1
 	github.com/mattn/go-sqlite3 v1.14.30
+	gopkg.in/yaml.v3 v3.0.1
 )
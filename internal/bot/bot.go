@@ -0,0 +1,159 @@
+// Package bot chooses actions for a computer controlled fencer.
+//
+// Like the engine it knows nothing about rooms or clients: Choose looks at an
+// engine.State from one side and returns the action to play.
+package bot
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"prisoner-fencing/internal/engine"
+)
+
+// Strengths a bot can play at.
+const (
+	Random    = "random"    // any action
+	Heuristic = "heuristic" // rules of thumb on distance, energy and Advanced
+	Lookahead = "lookahead" // searches the next turns assuming the worst reply
+)
+
+// lookaheadDepth is how many turns the Lookahead bot searches.
+const lookaheadDepth = 3
+
+// winScore is the value of a won duel, above any energy difference.
+const winScore = 1000
+
+// Valid reports whether strength is a known bot strength.
+func Valid(strength string) bool {
+	return strength == Random || strength == Heuristic || strength == Lookahead
+}
+
+// Bot picks actions at a fixed strength.
+type Bot struct {
+	strength string
+	rng      *rand.Rand
+}
+
+// New returns a bot of the given strength. A zero seed picks one from the
+// clock.
+func New(strength string, seed int64) (*Bot, error) {
+	if !Valid(strength) {
+		return nil, fmt.Errorf("unknown bot strength: %s", strength)
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Bot{strength: strength, rng: rand.New(rand.NewSource(seed))}, nil
+}
+
+// Choose returns the action to play in s for the player at index side.
+func (b *Bot) Choose(s engine.State, side int) engine.Action {
+	switch b.strength {
+	case Heuristic:
+		return b.heuristic(s, side)
+	case Lookahead:
+		return b.lookahead(s, side)
+	}
+	return engine.Actions[b.rng.Intn(len(engine.Actions))]
+}
+
+// heuristic closes the distance while it can afford to, strikes hardest when
+// adjacent, and sits on an energy lead near the end of the duel.
+func (b *Bot) heuristic(s engine.State, side int) engine.Action {
+	me, opp := s.Players[side], s.Players[1-side]
+	distance := me.Pos - opp.Pos
+	if distance < 0 {
+		distance = -distance
+	}
+	turnsLeft := s.MaxTurns - s.Turn
+
+	if distance == 1 {
+		switch {
+		case me.Advanced:
+			return engine.ActionAttack
+		case opp.Advanced:
+			// Their double attack is the one most worth reflecting
+			return engine.ActionCounter
+		case me.Energy > opp.Energy && turnsLeft <= 2:
+			return engine.ActionRetreat
+		case b.rng.Intn(3) == 0:
+			return engine.ActionCounter
+		}
+		return engine.ActionAttack
+	}
+
+	if me.Energy > opp.Energy && turnsLeft <= 2 {
+		return engine.ActionWait
+	}
+	if me.Energy <= s.Rules.AdvanceCost+s.Rules.MissCost {
+		return engine.ActionWait
+	}
+	return engine.ActionAdvance
+}
+
+// lookahead plays the action whose worst outcome over the next turns is
+// best, breaking ties on the average outcome and then at random.
+func (b *Bot) lookahead(s engine.State, side int) engine.Action {
+	var best []engine.Action
+	bestWorst, bestSum := math.MinInt, math.MinInt
+	for _, a := range engine.Actions {
+		worst, sum := math.MaxInt, 0
+		for _, o := range engine.Actions {
+			v := search(resolve(s, side, a, o), side, lookaheadDepth-1)
+			worst = min(worst, v)
+			sum += v
+		}
+		switch {
+		case worst > bestWorst || (worst == bestWorst && sum > bestSum):
+			best, bestWorst, bestSum = []engine.Action{a}, worst, sum
+		case worst == bestWorst && sum == bestSum:
+			best = append(best, a)
+		}
+	}
+	return best[b.rng.Intn(len(best))]
+}
+
+// search returns the maximin value of s for side, looking depth turns ahead.
+func search(s engine.State, side, depth int) int {
+	if depth == 0 || s.Result().Over {
+		return evaluate(s, side)
+	}
+	best := math.MinInt
+	for _, a := range engine.Actions {
+		worst := math.MaxInt
+		for _, o := range engine.Actions {
+			worst = min(worst, search(resolve(s, side, a, o), side, depth-1))
+			if worst <= best {
+				break // a is no better than an action already found
+			}
+		}
+		best = max(best, worst)
+	}
+	return best
+}
+
+// resolve plays a turn in which side chose a and the opponent chose o.
+func resolve(s engine.State, side int, a, o engine.Action) engine.State {
+	if side == 1 {
+		a, o = o, a
+	}
+	next, _ := engine.Resolve(s, a, o)
+	return next
+}
+
+// evaluate scores s for side: a won or lost duel, or else the energy lead.
+func evaluate(s engine.State, side int) int {
+	if r := s.Result(); r.Over {
+		switch r.Winner {
+		case 0:
+			return 0
+		case side + 1:
+			return winScore
+		}
+		return -winScore
+	}
+	return s.Players[side].Energy - s.Players[1-side].Energy
+}
@@ -0,0 +1,57 @@
+package bot
+
+import (
+	"testing"
+
+	"prisoner-fencing/internal/engine"
+)
+
+func TestNewRejectsUnknownStrength(t *testing.T) {
+	if _, err := New("grandmaster", 1); err == nil {
+		t.Errorf("Expected an unknown strength to be rejected")
+	}
+}
+
+func TestChooseReturnsAnAction(t *testing.T) {
+	for _, strength := range []string{Random, Heuristic, Lookahead} {
+		b, _ := New(strength, 1)
+		s := engine.NewState(engine.DefaultRuleset())
+		for side := range 2 {
+			if a := b.Choose(s, side); !a.Valid() {
+				t.Errorf("%s bot chose %q", strength, a)
+			}
+		}
+	}
+}
+
+func TestHeuristic(t *testing.T) {
+	b, _ := New(Heuristic, 1)
+	s := engine.NewState(engine.DefaultRuleset())
+
+	if a := b.Choose(s, 0); a != engine.ActionAdvance {
+		t.Errorf("Expected ADVANCE from a distance, got %s", a)
+	}
+
+	s.Players[0].Pos, s.Players[1].Pos = 3, 4
+	s.Players[1].Advanced = true
+	if a := b.Choose(s, 0); a != engine.ActionCounter {
+		t.Errorf("Expected COUNTER against an advanced opponent, got %s", a)
+	}
+
+	s.Players[0].Advanced = true
+	if a := b.Choose(s, 0); a != engine.ActionAttack {
+		t.Errorf("Expected ATTACK when advanced, got %s", a)
+	}
+}
+
+func TestLookaheadAvoidsLosingMoves(t *testing.T) {
+	b, _ := New(Lookahead, 1)
+	s := engine.NewState(engine.DefaultRuleset())
+	s.Players[0].Pos, s.Players[1].Pos = 1, 5
+	s.Players[1].Energy = 1
+
+	// Anything but WAIT leaves player 2 without energy
+	if a := b.Choose(s, 1); a != engine.ActionWait {
+		t.Errorf("Expected WAIT on 1 energy, got %s", a)
+	}
+}
@@ -22,6 +22,50 @@ type Service interface {
 	// Close terminates the database connection.
 	// It returns an error if the connection cannot be closed.
 	Close() error
+
+	// SaveMatch stores a completed match with its participants and turns,
+	// and returns its id.
+	SaveMatch(ctx context.Context, m Match) (int64, error)
+
+	// GetMatch returns the match with the given id. It returns ErrNotFound
+	// if there is none.
+	GetMatch(ctx context.Context, id int64) (Match, error)
+
+	// ListMatchesByPlayer returns up to limit of the player's most recent
+	// matches, without their turns.
+	ListMatchesByPlayer(ctx context.Context, playerId string, limit int) ([]Match, error)
+
+	// TopRatings returns the limit highest rated players.
+	TopRatings(ctx context.Context, limit int) ([]Rating, error)
+
+	// GetRating returns a player's current rating. A player without rated
+	// matches has the initial rating.
+	GetRating(ctx context.Context, playerId string) (Rating, error)
+
+	// RatingHistory returns how each of the player's rated matches changed
+	// their rating, most recent first.
+	RatingHistory(ctx context.Context, playerId string, limit int) ([]RatingChange, error)
+
+	// CreatePlayer registers a player. It returns ErrNameTaken if the display
+	// name is in use, ignoring case.
+	CreatePlayer(ctx context.Context, p Player) error
+
+	// UpdatePlayer changes a registered player's display name and avatar. It
+	// returns ErrNotFound for an unregistered player and ErrNameTaken if the
+	// new name is in use.
+	UpdatePlayer(ctx context.Context, p Player) error
+
+	// GetPlayer returns a registered player. It returns ErrNotFound if there
+	// is none.
+	GetPlayer(ctx context.Context, id string) (Player, error)
+
+	// SaveSeries stores a finished best-of series and returns its id. Its
+	// matches must have been stored already.
+	SaveSeries(ctx context.Context, series Series) (int64, error)
+
+	// GetSeries returns the series with the given id. It returns ErrNotFound
+	// if there is none.
+	GetSeries(ctx context.Context, id int64) (Series, error)
 }
 
 type service struct {
@@ -39,17 +83,28 @@ func New() Service {
 		return dbInstance
 	}
 
-	db, err := sql.Open("sqlite3", dburl)
+	s, err := Open(dburl)
 	if err != nil {
-		// This will not be a connection error, but a DSN parse error or
-		// another initialization error.
 		log.Fatal(err)
 	}
+	dbInstance = s.(*service)
+	return dbInstance
+}
 
-	dbInstance = &service{
-		db: db,
+// Open connects to the SQLite database at url and migrates it to the latest
+// schema. Unlike New it does not reuse an existing connection.
+func Open(url string) (Service, error) {
+	db, err := sql.Open("sqlite3", url)
+	if err != nil {
+		// This will not be a connection error, but a DSN parse error or
+		// another initialization error.
+		return nil, err
 	}
-	return dbInstance
+	if err := migrateUp(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %v", err)
+	}
+	return &service{db: db}, nil
 }
 
 // Health checks the health of the database connection by pinging the database.
@@ -0,0 +1,269 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"prisoner-fencing/internal/engine"
+)
+
+// ErrNotFound is returned when a requested record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Match is the record of a completed game.
+type Match struct {
+	ID           int64          `json:"id"`
+	Room         string         `json:"room"`
+	Ruleset      string         `json:"ruleset"`
+	Rules        engine.Ruleset `json:"rules"` // the ruleset as it was when the match was played
+	StartedAt    time.Time      `json:"startedAt"`
+	EndedAt      time.Time      `json:"endedAt"`
+	Winner       int            `json:"winner"` // seat of the winner, 0 for a draw
+	Reason       string         `json:"reason"`
+	Rated        bool           `json:"rated"` // whether the result moved the players' ratings
+	TurnCount    int            `json:"turnCount"`
+	Participants []Participant  `json:"participants"`
+	Turns        []Turn         `json:"turns,omitempty"`
+}
+
+// Participant is a player seated in a match.
+type Participant struct {
+	Seat        int    `json:"seat"` // 1 or 2
+	PlayerId    string `json:"playerId"`
+	FinalPos    int    `json:"finalPos"`
+	FinalEnergy int    `json:"finalEnergy"`
+}
+
+// Turn is one resolved turn of a match.
+type Turn struct {
+	Turn     int              `json:"turn"`
+	Actions  [2]engine.Action `json:"actions"` // of player 1 and player 2
+	Players  [2]TurnPlayer    `json:"players"` // of player 1 and player 2
+	Log      string           `json:"log"`
+	Outcomes []engine.Outcome `json:"outcomes"`
+}
+
+// TurnPlayer is a player's state either side of a turn, and in a
+// commit-reveal game the commitment they made to their action and the nonce
+// that opened it, so the turn can be audited later.
+type TurnPlayer struct {
+	Before     engine.Player `json:"before"`
+	After      engine.Player `json:"after"`
+	Commitment string        `json:"commitment,omitempty"`
+	Nonce      string        `json:"nonce,omitempty"`
+}
+
+func (s *service) SaveMatch(ctx context.Context, m Match) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rules, err := json.Marshal(m.Rules)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal rules: %v", err)
+	}
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO matches (room, ruleset, rules, started_at, ended_at, winner, reason, rated, turns) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.Room, m.Ruleset, string(rules), m.StartedAt.UnixMilli(), m.EndedAt.UnixMilli(), m.Winner, m.Reason, m.Rated, m.TurnCount)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert match: %v", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get match id: %v", err)
+	}
+
+	for _, p := range m.Participants {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO match_participants (match_id, seat, player_id, final_pos, final_energy) VALUES (?, ?, ?, ?, ?)`,
+			id, p.Seat, p.PlayerId, p.FinalPos, p.FinalEnergy); err != nil {
+			return 0, fmt.Errorf("failed to insert participant: %v", err)
+		}
+	}
+	for _, t := range m.Turns {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO match_turns (match_id, turn, player1_action, player2_action, log) VALUES (?, ?, ?, ?, ?)`,
+			id, t.Turn, t.Actions[0], t.Actions[1], t.Log); err != nil {
+			return 0, fmt.Errorf("failed to insert turn: %v", err)
+		}
+		for i, p := range t.Players {
+			if _, err := tx.ExecContext(ctx,
+				`INSERT INTO match_turn_players (match_id, turn, seat, pos_before, energy_before, advanced_before, pos_after, energy_after, advanced_after, commitment, nonce) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				id, t.Turn, i+1, p.Before.Pos, p.Before.Energy, p.Before.Advanced, p.After.Pos, p.After.Energy, p.After.Advanced, p.Commitment, p.Nonce); err != nil {
+				return 0, fmt.Errorf("failed to insert turn player: %v", err)
+			}
+		}
+		for seq, o := range t.Outcomes {
+			if _, err := tx.ExecContext(ctx,
+				`INSERT INTO match_outcomes (match_id, turn, seq, player, action, kind, amount, message) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				id, t.Turn, seq, o.Player, o.Action, string(o.Kind), o.Amount, o.Message); err != nil {
+				return 0, fmt.Errorf("failed to insert outcome: %v", err)
+			}
+		}
+	}
+
+	if m.Rated {
+		if err := updateRatings(ctx, tx, id, m); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit match: %v", err)
+	}
+	return id, nil
+}
+
+func (s *service) GetMatch(ctx context.Context, id int64) (Match, error) {
+	row := s.db.QueryRowContext(ctx,
+		`SELECT id, room, ruleset, rules, started_at, ended_at, winner, reason, rated, turns FROM matches WHERE id = ?`, id)
+	m, err := scanMatch(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Match{}, ErrNotFound
+	}
+	if err != nil {
+		return Match{}, fmt.Errorf("failed to get match: %v", err)
+	}
+	if m.Participants, err = s.participants(ctx, id); err != nil {
+		return Match{}, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT turn, player1_action, player2_action, log FROM match_turns WHERE match_id = ? ORDER BY turn`, id)
+	if err != nil {
+		return Match{}, fmt.Errorf("failed to get turns: %v", err)
+	}
+	defer rows.Close()
+	turns := make(map[int]int) // turn -> index in m.Turns
+	for rows.Next() {
+		var t Turn
+		if err := rows.Scan(&t.Turn, &t.Actions[0], &t.Actions[1], &t.Log); err != nil {
+			return Match{}, fmt.Errorf("failed to scan turn: %v", err)
+		}
+		turns[t.Turn] = len(m.Turns)
+		m.Turns = append(m.Turns, t)
+	}
+	if err := rows.Err(); err != nil {
+		return Match{}, fmt.Errorf("failed to get turns: %v", err)
+	}
+
+	outcomes, err := s.db.QueryContext(ctx,
+		`SELECT turn, player, action, kind, amount, message FROM match_outcomes WHERE match_id = ? ORDER BY turn, seq`, id)
+	if err != nil {
+		return Match{}, fmt.Errorf("failed to get outcomes: %v", err)
+	}
+	defer outcomes.Close()
+	for outcomes.Next() {
+		var turn int
+		var o engine.Outcome
+		if err := outcomes.Scan(&turn, &o.Player, &o.Action, &o.Kind, &o.Amount, &o.Message); err != nil {
+			return Match{}, fmt.Errorf("failed to scan outcome: %v", err)
+		}
+		if i, ok := turns[turn]; ok {
+			m.Turns[i].Outcomes = append(m.Turns[i].Outcomes, o)
+		}
+	}
+	if err := outcomes.Err(); err != nil {
+		return Match{}, fmt.Errorf("failed to get outcomes: %v", err)
+	}
+
+	players, err := s.db.QueryContext(ctx,
+		`SELECT turn, seat, pos_before, energy_before, advanced_before, pos_after, energy_after, advanced_after, commitment, nonce
+		FROM match_turn_players WHERE match_id = ?`, id)
+	if err != nil {
+		return Match{}, fmt.Errorf("failed to get turn players: %v", err)
+	}
+	defer players.Close()
+	for players.Next() {
+		var turn, seat int
+		var p TurnPlayer
+		if err := players.Scan(&turn, &seat, &p.Before.Pos, &p.Before.Energy, &p.Before.Advanced, &p.After.Pos, &p.After.Energy, &p.After.Advanced, &p.Commitment, &p.Nonce); err != nil {
+			return Match{}, fmt.Errorf("failed to scan turn player: %v", err)
+		}
+		if i, ok := turns[turn]; ok && (seat == 1 || seat == 2) {
+			m.Turns[i].Players[seat-1] = p
+		}
+	}
+	if err := players.Err(); err != nil {
+		return Match{}, fmt.Errorf("failed to get turn players: %v", err)
+	}
+	return m, nil
+}
+
+func (s *service) ListMatchesByPlayer(ctx context.Context, playerId string, limit int) ([]Match, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT m.id, m.room, m.ruleset, m.rules, m.started_at, m.ended_at, m.winner, m.reason, m.rated, m.turns
+		FROM matches m JOIN match_participants p ON p.match_id = m.id
+		WHERE p.player_id = ? ORDER BY m.ended_at DESC, m.id DESC LIMIT ?`, playerId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list matches: %v", err)
+	}
+	defer rows.Close()
+
+	matches := []Match{}
+	for rows.Next() {
+		m, err := scanMatch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan match: %v", err)
+		}
+		matches = append(matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list matches: %v", err)
+	}
+	rows.Close()
+
+	for i := range matches {
+		if matches[i].Participants, err = s.participants(ctx, matches[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return matches, nil
+}
+
+// participants returns the players seated in match id.
+func (s *service) participants(ctx context.Context, id int64) ([]Participant, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT seat, player_id, final_pos, final_energy FROM match_participants WHERE match_id = ? ORDER BY seat`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get participants: %v", err)
+	}
+	defer rows.Close()
+
+	var participants []Participant
+	for rows.Next() {
+		var p Participant
+		if err := rows.Scan(&p.Seat, &p.PlayerId, &p.FinalPos, &p.FinalEnergy); err != nil {
+			return nil, fmt.Errorf("failed to scan participant: %v", err)
+		}
+		participants = append(participants, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get participants: %v", err)
+	}
+	return participants, nil
+}
+
+// scanMatch reads the columns of the matches table selected in GetMatch.
+func scanMatch(row interface{ Scan(...any) error }) (Match, error) {
+	var m Match
+	var rules string
+	var started, ended int64
+	if err := row.Scan(&m.ID, &m.Room, &m.Ruleset, &rules, &started, &ended, &m.Winner, &m.Reason, &m.Rated, &m.TurnCount); err != nil {
+		return Match{}, err
+	}
+	// Matches stored before rules were recorded have none
+	if rules != "" {
+		if err := json.Unmarshal([]byte(rules), &m.Rules); err != nil {
+			return Match{}, fmt.Errorf("failed to unmarshal rules: %v", err)
+		}
+	}
+	m.StartedAt, m.EndedAt = time.UnixMilli(started), time.UnixMilli(ended)
+	return m, nil
+}
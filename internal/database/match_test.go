@@ -0,0 +1,178 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"prisoner-fencing/internal/engine"
+	"prisoner-fencing/internal/rating"
+)
+
+// newTestService opens a fresh database in a temporary directory.
+func newTestService(t *testing.T) Service {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSaveAndGetMatch(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	start := time.UnixMilli(time.Now().UnixMilli())
+
+	m := Match{
+		Room:      "arena",
+		Ruleset:   engine.DefaultRulesetName,
+		StartedAt: start,
+		EndedAt:   start.Add(time.Minute),
+		Winner:    2,
+		Reason:    "elimination",
+		TurnCount: 1,
+		Participants: []Participant{
+			{Seat: 1, PlayerId: "p1", FinalPos: 2, FinalEnergy: 0},
+			{Seat: 2, PlayerId: "p2", FinalPos: 3, FinalEnergy: 9},
+		},
+		Turns: []Turn{{
+			Turn:    1,
+			Actions: [2]engine.Action{engine.ActionWait, engine.ActionAdvance},
+			Players: [2]TurnPlayer{
+				{Commitment: engine.Commitment(engine.ActionWait, "n1"), Nonce: "n1"},
+				{Commitment: engine.Commitment(engine.ActionAdvance, "n2"), Nonce: "n2"},
+			},
+			Log: "P1: WAIT: +1 Energy | P2: ADVANCE: Double attack next turn",
+			Outcomes: []engine.Outcome{
+				{Player: 1, Action: engine.ActionWait, Kind: engine.OutcomeRest, Amount: 1, Message: "WAIT: +1 Energy"},
+				{Player: 2, Action: engine.ActionAdvance, Kind: engine.OutcomeAdvance, Amount: 1, Message: "ADVANCE: Double attack next turn"},
+			},
+		}},
+	}
+	id, err := s.SaveMatch(ctx, m)
+	if err != nil {
+		t.Fatalf("failed to save match: %v", err)
+	}
+
+	got, err := s.GetMatch(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to get match: %v", err)
+	}
+	if got.Room != m.Room || got.Winner != 2 || !got.StartedAt.Equal(m.StartedAt) || !got.EndedAt.Equal(m.EndedAt) {
+		t.Errorf("Expected the saved match back, got %+v", got)
+	}
+	if len(got.Participants) != 2 || got.Participants[1] != m.Participants[1] {
+		t.Errorf("Expected both participants back, got %+v", got.Participants)
+	}
+	if len(got.Turns) != 1 || got.Turns[0].Actions != m.Turns[0].Actions || len(got.Turns[0].Outcomes) != 2 || got.Turns[0].Outcomes[1] != m.Turns[0].Outcomes[1] {
+		t.Errorf("Expected the turn and its outcomes back, got %+v", got.Turns)
+	}
+	if len(got.Turns) == 1 && got.Turns[0].Players != m.Turns[0].Players {
+		t.Errorf("Expected the commitments and nonces back, got %+v", got.Turns[0].Players)
+	}
+
+	if _, err := s.GetMatch(ctx, id+1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing match, got %v", err)
+	}
+}
+
+func TestListMatchesByPlayer(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	start := time.Now()
+
+	for i, opponent := range []string{"p2", "p3", "p2"} {
+		m := Match{
+			Room:      "arena",
+			Ruleset:   engine.DefaultRulesetName,
+			StartedAt: start,
+			EndedAt:   start.Add(time.Duration(i) * time.Minute),
+			Reason:    "energy",
+			Participants: []Participant{
+				{Seat: 1, PlayerId: "p1"},
+				{Seat: 2, PlayerId: opponent},
+			},
+		}
+		if _, err := s.SaveMatch(ctx, m); err != nil {
+			t.Fatalf("failed to save match: %v", err)
+		}
+	}
+
+	matches, err := s.ListMatchesByPlayer(ctx, "p2", 10)
+	if err != nil {
+		t.Fatalf("failed to list matches: %v", err)
+	}
+	if len(matches) != 2 || matches[0].EndedAt.Before(matches[1].EndedAt) {
+		t.Errorf("Expected p2's 2 matches, newest first, got %+v", matches)
+	}
+	if len(matches[0].Participants) != 2 || len(matches[0].Turns) != 0 {
+		t.Errorf("Expected participants without turns, got %+v", matches[0])
+	}
+
+	if matches, _ := s.ListMatchesByPlayer(ctx, "p1", 1); len(matches) != 1 {
+		t.Errorf("Expected the limit to apply, got %d matches", len(matches))
+	}
+}
+
+func TestRatedMatchUpdatesRatings(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	start := time.Now()
+
+	save := func(winner int, rated bool, minute int) int64 {
+		t.Helper()
+		id, err := s.SaveMatch(ctx, Match{
+			Room:      "arena",
+			Ruleset:   engine.DefaultRulesetName,
+			StartedAt: start,
+			EndedAt:   start.Add(time.Duration(minute) * time.Minute),
+			Winner:    winner,
+			Reason:    "elimination",
+			Rated:     rated,
+			Participants: []Participant{
+				{Seat: 1, PlayerId: "p1"},
+				{Seat: 2, PlayerId: "p2"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to save match: %v", err)
+		}
+		return id
+	}
+	first := save(1, true, 1)
+	save(2, false, 2) // casual, changes nothing
+	last := save(0, true, 3)
+
+	top, err := s.TopRatings(ctx, 10)
+	if err != nil {
+		t.Fatalf("failed to get top ratings: %v", err)
+	}
+	if len(top) != 2 || top[0].PlayerId != "p1" || top[0].Games != 2 || top[0].Rating <= top[1].Rating {
+		t.Errorf("Expected p1 to lead after 2 rated matches, got %+v", top)
+	}
+	if top, _ := s.TopRatings(ctx, 1); len(top) != 1 {
+		t.Errorf("Expected the limit to apply, got %d ratings", len(top))
+	}
+
+	history, err := s.RatingHistory(ctx, "p2", 10)
+	if err != nil {
+		t.Fatalf("failed to get rating history: %v", err)
+	}
+	if len(history) != 2 || history[0].MatchId != last || history[1].MatchId != first {
+		t.Fatalf("Expected p2's 2 rated matches, newest first, got %+v", history)
+	}
+	if history[1].Before != rating.Initial || history[1].After != 1484 || history[0].Before != 1484 || history[0].After <= 1484 {
+		t.Errorf("Expected a loss then a draw against a stronger player, got %+v", history)
+	}
+
+	if r, err := s.GetRating(ctx, "p2"); err != nil || r.Rating != history[0].After || r.Games != 2 {
+		t.Errorf("Expected p2's current rating %d after 2 games, got %+v, %v", history[0].After, r, err)
+	}
+	if r, err := s.GetRating(ctx, "p3"); err != nil || r.Rating != rating.Initial || r.Games != 0 {
+		t.Errorf("Expected the initial rating for a new player, got %+v, %v", r, err)
+	}
+}
@@ -0,0 +1,177 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations are numbered SQL files, NNNN_name.up.sql with a matching
+// NNNN_name.down.sql that undoes it. Numbers start at 1 and have no gaps.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration is one step of the schema.
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// versionTable records every migration applied to the database. The schema
+// version is the highest one.
+const versionTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT    NOT NULL,
+	applied_at INTEGER NOT NULL
+)`
+
+// loadMigrations returns the embedded migrations in order.
+func loadMigrations() ([]migration, error) {
+	files, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %v", err)
+	}
+	byVersion := make(map[int]*migration)
+	for _, file := range files {
+		base := strings.TrimPrefix(file, "migrations/")
+		stem, direction, ok := strings.Cut(strings.TrimSuffix(base, ".sql"), ".")
+		number, name, named := strings.Cut(stem, "_")
+		version, err := strconv.Atoi(number)
+		if !ok || !named || err != nil || version < 1 || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("badly named migration: %s", base)
+		}
+		data, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %v", base, err)
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &migration{version: version, name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.up = string(data)
+		} else {
+			m.down = string(data)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	for i, m := range migrations {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d needs both an up and a down file", m.version)
+		}
+	}
+	return migrations, nil
+}
+
+// schemaVersion returns the version of the schema in db, 0 for an empty one.
+func schemaVersion(db *sql.DB) (int, error) {
+	if _, err := db.Exec(versionTable); err != nil {
+		return 0, fmt.Errorf("failed to create version table: %v", err)
+	}
+	var version int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %v", err)
+	}
+	return version, nil
+}
+
+// migrateUp applies every migration db does not have yet. It refuses to touch
+// a database whose schema is newer than this binary knows about.
+func migrateUp(db *sql.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than the latest known version %d", version, len(migrations))
+	}
+
+	for _, m := range migrations[version:] {
+		if err := applyMigration(db, m.version, m.up, func(tx *sql.Tx) error {
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`, m.version, m.name, time.Now().UnixMilli())
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateDown rolls the database at url back to schema version target by
+// running down migrations, and returns the version it was at before.
+func MigrateDown(url string, target int) (int, error) {
+	db, err := sql.Open("sqlite3", url)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	version, err := schemaVersion(db)
+	if err != nil {
+		return 0, err
+	}
+	if version > len(migrations) {
+		return version, fmt.Errorf("database schema version %d is newer than the latest known version %d, use a newer binary to roll it back", version, len(migrations))
+	}
+	if target < 0 || target > version {
+		return version, fmt.Errorf("cannot migrate down from version %d to %d", version, target)
+	}
+
+	for i := version; i > target; i-- {
+		m := migrations[i-1]
+		if err := applyMigration(db, m.version, m.down, func(tx *sql.Tx) error {
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.version)
+			return err
+		}); err != nil {
+			return version, err
+		}
+	}
+	return version, nil
+}
+
+// applyMigration runs the SQL of a migration and records it with record, in
+// one transaction.
+func applyMigration(db *sql.DB, version int, script string, record func(*sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin migration %d: %v", version, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(script); err != nil {
+		return fmt.Errorf("failed to run migration %d: %v", version, err)
+	}
+	if err := record(tx); err != nil {
+		return fmt.Errorf("failed to record migration %d: %v", version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %d: %v", version, err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	url := filepath.Join(t.TempDir(), "test.db")
+	s, err := Open(url)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db := s.(*service).db
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if version, _ := schemaVersion(db); version != len(migrations) {
+		t.Errorf("Expected schema version %d after opening, got %d", len(migrations), version)
+	}
+
+	// Opening again has nothing left to apply
+	if err := migrateUp(db); err != nil {
+		t.Errorf("Expected a second migration to be a no-op, got %v", err)
+	}
+	s.Close()
+
+	from, err := MigrateDown(url, 0)
+	if err != nil || from != len(migrations) {
+		t.Fatalf("failed to migrate down from %d: %v", from, err)
+	}
+	db, err = sql.Open("sqlite3", url)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	var tables int
+	db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'matches'`).Scan(&tables)
+	if version, _ := schemaVersion(db); version != 0 || tables != 0 {
+		t.Errorf("Expected an empty schema after migrating down, got version %d", version)
+	}
+}
+
+func TestOpenRefusesNewerSchema(t *testing.T) {
+	url := filepath.Join(t.TempDir(), "test.db")
+	s, err := Open(url)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if _, err := s.(*service).db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (9999, 'future', 0)`); err != nil {
+		t.Fatalf("failed to fake a newer schema: %v", err)
+	}
+	s.Close()
+
+	if _, err := Open(url); err == nil {
+		t.Errorf("Expected a database from a newer binary to be refused")
+	}
+	if _, err := MigrateDown(url, 0); err == nil {
+		t.Errorf("Expected migrating down a newer schema to be refused")
+	}
+}
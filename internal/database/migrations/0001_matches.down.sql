@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS match_outcomes;
+DROP TABLE IF EXISTS match_turns;
+DROP INDEX IF EXISTS match_participants_player;
+DROP TABLE IF EXISTS match_participants;
+DROP TABLE IF EXISTS matches;
@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS matches (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	room       TEXT    NOT NULL,
+	ruleset    TEXT    NOT NULL,
+	started_at INTEGER NOT NULL,
+	ended_at   INTEGER NOT NULL,
+	winner     INTEGER NOT NULL,
+	reason     TEXT    NOT NULL,
+	turns      INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS match_participants (
+	match_id     INTEGER NOT NULL REFERENCES matches(id),
+	seat         INTEGER NOT NULL,
+	player_id    TEXT    NOT NULL,
+	final_pos    INTEGER NOT NULL,
+	final_energy INTEGER NOT NULL,
+	PRIMARY KEY (match_id, seat)
+);
+CREATE INDEX IF NOT EXISTS match_participants_player ON match_participants(player_id);
+
+CREATE TABLE IF NOT EXISTS match_turns (
+	match_id       INTEGER NOT NULL REFERENCES matches(id),
+	turn           INTEGER NOT NULL,
+	player1_action TEXT    NOT NULL,
+	player2_action TEXT    NOT NULL,
+	log            TEXT    NOT NULL,
+	PRIMARY KEY (match_id, turn)
+);
+
+CREATE TABLE IF NOT EXISTS match_outcomes (
+	match_id INTEGER NOT NULL REFERENCES matches(id),
+	turn     INTEGER NOT NULL,
+	seq      INTEGER NOT NULL,
+	player   INTEGER NOT NULL,
+	action   TEXT    NOT NULL,
+	kind     TEXT    NOT NULL,
+	amount   INTEGER NOT NULL,
+	message  TEXT    NOT NULL,
+	PRIMARY KEY (match_id, turn, seq)
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS rating_history;
+DROP INDEX IF EXISTS ratings_rating;
+DROP TABLE IF EXISTS ratings;
+ALTER TABLE matches DROP COLUMN rated;
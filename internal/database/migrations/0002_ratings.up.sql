@@ -0,0 +1,18 @@
+ALTER TABLE matches ADD COLUMN rated INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE ratings (
+	player_id  TEXT    PRIMARY KEY,
+	rating     INTEGER NOT NULL,
+	games      INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+CREATE INDEX ratings_rating ON ratings(rating DESC);
+
+CREATE TABLE rating_history (
+	player_id     TEXT    NOT NULL,
+	match_id      INTEGER NOT NULL REFERENCES matches(id),
+	rating_before INTEGER NOT NULL,
+	rating_after  INTEGER NOT NULL,
+	created_at    INTEGER NOT NULL,
+	PRIMARY KEY (player_id, match_id)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS match_turn_players;
+ALTER TABLE matches DROP COLUMN rules;
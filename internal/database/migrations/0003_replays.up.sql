@@ -0,0 +1,14 @@
+ALTER TABLE matches ADD COLUMN rules TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE match_turn_players (
+	match_id        INTEGER NOT NULL REFERENCES matches(id),
+	turn            INTEGER NOT NULL,
+	seat            INTEGER NOT NULL,
+	pos_before      INTEGER NOT NULL,
+	energy_before   INTEGER NOT NULL,
+	advanced_before INTEGER NOT NULL,
+	pos_after       INTEGER NOT NULL,
+	energy_after    INTEGER NOT NULL,
+	advanced_after  INTEGER NOT NULL,
+	PRIMARY KEY (match_id, turn, seat)
+);
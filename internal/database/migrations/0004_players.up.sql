@@ -0,0 +1,6 @@
+CREATE TABLE players (
+	id           TEXT    PRIMARY KEY,
+	display_name TEXT    NOT NULL UNIQUE COLLATE NOCASE,
+	avatar       TEXT    NOT NULL,
+	created_at   INTEGER NOT NULL
+);
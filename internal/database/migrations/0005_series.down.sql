@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS series_matches;
+DROP TABLE IF EXISTS series;
@@ -0,0 +1,20 @@
+CREATE TABLE series (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	room         TEXT    NOT NULL,
+	best_of      INTEGER NOT NULL,
+	started_at   INTEGER NOT NULL,
+	ended_at     INTEGER NOT NULL,
+	player1_id   TEXT    NOT NULL,
+	player2_id   TEXT    NOT NULL,
+	player1_wins INTEGER NOT NULL,
+	player2_wins INTEGER NOT NULL,
+	winner       INTEGER NOT NULL,
+	reason       TEXT    NOT NULL
+);
+
+CREATE TABLE series_matches (
+	series_id INTEGER NOT NULL REFERENCES series(id),
+	game      INTEGER NOT NULL,
+	match_id  INTEGER NOT NULL REFERENCES matches(id),
+	PRIMARY KEY (series_id, game)
+);
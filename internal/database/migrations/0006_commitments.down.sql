@@ -0,0 +1,2 @@
+ALTER TABLE match_turn_players DROP COLUMN nonce;
+ALTER TABLE match_turn_players DROP COLUMN commitment;
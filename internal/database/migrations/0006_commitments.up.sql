@@ -0,0 +1,2 @@
+ALTER TABLE match_turn_players ADD COLUMN commitment TEXT NOT NULL DEFAULT '';
+ALTER TABLE match_turn_players ADD COLUMN nonce TEXT NOT NULL DEFAULT '';
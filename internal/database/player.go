@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNameTaken is returned when another player already has a display name.
+var ErrNameTaken = errors.New("display name is taken")
+
+// Player is a registered player's profile.
+type Player struct {
+	Id          string    `json:"id"`
+	DisplayName string    `json:"displayName"`
+	Avatar      string    `json:"avatar"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+func (s *service) CreatePlayer(ctx context.Context, p Player) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO players (id, display_name, avatar, created_at) VALUES (?, ?, ?, ?)`,
+		p.Id, p.DisplayName, p.Avatar, p.CreatedAt.UnixMilli())
+	if err != nil {
+		return playerError("create", err)
+	}
+	return nil
+}
+
+func (s *service) UpdatePlayer(ctx context.Context, p Player) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE players SET display_name = ?, avatar = ? WHERE id = ?`, p.DisplayName, p.Avatar, p.Id)
+	if err != nil {
+		return playerError("update", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *service) GetPlayer(ctx context.Context, id string) (Player, error) {
+	var p Player
+	var created int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, display_name, avatar, created_at FROM players WHERE id = ?`, id).Scan(&p.Id, &p.DisplayName, &p.Avatar, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Player{}, ErrNotFound
+	}
+	if err != nil {
+		return Player{}, fmt.Errorf("failed to get player: %v", err)
+	}
+	p.CreatedAt = time.UnixMilli(created)
+	return p, nil
+}
+
+// playerError turns a failed write to the players table into an error,
+// ErrNameTaken if it broke the unique display name.
+func playerError(op string, err error) error {
+	if strings.Contains(err.Error(), "UNIQUE constraint failed: players.display_name") {
+		return ErrNameTaken
+	}
+	return fmt.Errorf("failed to %s player: %v", op, err)
+}
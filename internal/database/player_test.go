@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPlayers(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	created := time.UnixMilli(time.Now().UnixMilli())
+
+	if err := s.CreatePlayer(ctx, Player{Id: "p1", DisplayName: "Zorro", Avatar: "fencer", CreatedAt: created}); err != nil {
+		t.Fatalf("failed to create player: %v", err)
+	}
+	if err := s.CreatePlayer(ctx, Player{Id: "p2", DisplayName: "zorro", Avatar: "rogue", CreatedAt: created}); !errors.Is(err, ErrNameTaken) {
+		t.Errorf("Expected a name differing only in case to be taken, got %v", err)
+	}
+	if err := s.CreatePlayer(ctx, Player{Id: "p2", DisplayName: "Musketeer", Avatar: "rogue", CreatedAt: created}); err != nil {
+		t.Fatalf("failed to create player: %v", err)
+	}
+
+	if err := s.UpdatePlayer(ctx, Player{Id: "p2", DisplayName: "ZORRO", Avatar: "rogue"}); !errors.Is(err, ErrNameTaken) {
+		t.Errorf("Expected renaming to a taken name to fail, got %v", err)
+	}
+	if err := s.UpdatePlayer(ctx, Player{Id: "p1", DisplayName: "Zorro", Avatar: "knight"}); err != nil {
+		t.Errorf("failed to update player: %v", err)
+	}
+	if err := s.UpdatePlayer(ctx, Player{Id: "p3", DisplayName: "Nobody", Avatar: "knight"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected updating an unregistered player to fail, got %v", err)
+	}
+
+	p, err := s.GetPlayer(ctx, "p1")
+	if err != nil {
+		t.Fatalf("failed to get player: %v", err)
+	}
+	if p.DisplayName != "Zorro" || p.Avatar != "knight" || !p.CreatedAt.Equal(created) {
+		t.Errorf("Expected the updated profile, got %+v", p)
+	}
+	if _, err := s.GetPlayer(ctx, "p3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unregistered player, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"prisoner-fencing/internal/rating"
+)
+
+// Rating is a player's current rating.
+type Rating struct {
+	PlayerId  string    `json:"playerId"`
+	Rating    int       `json:"rating"`
+	Games     int       `json:"games"` // rated matches played
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// RatingChange is what one rated match did to a player's rating.
+type RatingChange struct {
+	MatchId int64     `json:"matchId"`
+	Before  int       `json:"before"`
+	After   int       `json:"after"`
+	At      time.Time `json:"at"`
+}
+
+// updateRatings moves the ratings of both participants of rated match id by
+// its result, as part of the transaction that stores it.
+func updateRatings(ctx context.Context, tx *sql.Tx, id int64, m Match) error {
+	if len(m.Participants) != 2 {
+		return fmt.Errorf("rated match needs 2 participants, got %d", len(m.Participants))
+	}
+	var before [2]int
+	var games [2]int
+	for i, p := range m.Participants {
+		err := tx.QueryRowContext(ctx, `SELECT rating, games FROM ratings WHERE player_id = ?`, p.PlayerId).Scan(&before[i], &games[i])
+		if errors.Is(err, sql.ErrNoRows) {
+			before[i] = rating.Initial
+		} else if err != nil {
+			return fmt.Errorf("failed to get rating: %v", err)
+		}
+	}
+
+	score := rating.Draw
+	switch m.Winner {
+	case m.Participants[0].Seat:
+		score = rating.Win
+	case m.Participants[1].Seat:
+		score = rating.Loss
+	}
+	var after [2]int
+	after[0], after[1] = rating.Update(before[0], before[1], score)
+
+	now := m.EndedAt.UnixMilli()
+	for i, p := range m.Participants {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO ratings (player_id, rating, games, updated_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (player_id) DO UPDATE SET rating = excluded.rating, games = excluded.games, updated_at = excluded.updated_at`,
+			p.PlayerId, after[i], games[i]+1, now); err != nil {
+			return fmt.Errorf("failed to update rating: %v", err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO rating_history (player_id, match_id, rating_before, rating_after, created_at) VALUES (?, ?, ?, ?, ?)`,
+			p.PlayerId, id, before[i], after[i], now); err != nil {
+			return fmt.Errorf("failed to record rating change: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *service) TopRatings(ctx context.Context, limit int) ([]Rating, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT player_id, rating, games, updated_at FROM ratings ORDER BY rating DESC, games DESC, player_id LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top ratings: %v", err)
+	}
+	defer rows.Close()
+
+	ratings := []Rating{}
+	for rows.Next() {
+		var r Rating
+		var updated int64
+		if err := rows.Scan(&r.PlayerId, &r.Rating, &r.Games, &updated); err != nil {
+			return nil, fmt.Errorf("failed to scan rating: %v", err)
+		}
+		r.UpdatedAt = time.UnixMilli(updated)
+		ratings = append(ratings, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get top ratings: %v", err)
+	}
+	return ratings, nil
+}
+
+func (s *service) GetRating(ctx context.Context, playerId string) (Rating, error) {
+	r := Rating{PlayerId: playerId, Rating: rating.Initial}
+	var updated int64
+	err := s.db.QueryRowContext(ctx, `SELECT rating, games, updated_at FROM ratings WHERE player_id = ?`, playerId).Scan(&r.Rating, &r.Games, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return r, nil
+	}
+	if err != nil {
+		return Rating{}, fmt.Errorf("failed to get rating: %v", err)
+	}
+	r.UpdatedAt = time.UnixMilli(updated)
+	return r, nil
+}
+
+func (s *service) RatingHistory(ctx context.Context, playerId string, limit int) ([]RatingChange, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT match_id, rating_before, rating_after, created_at FROM rating_history
+		WHERE player_id = ? ORDER BY created_at DESC, match_id DESC LIMIT ?`, playerId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rating history: %v", err)
+	}
+	defer rows.Close()
+
+	changes := []RatingChange{}
+	for rows.Next() {
+		var c RatingChange
+		var at int64
+		if err := rows.Scan(&c.MatchId, &c.Before, &c.After, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan rating change: %v", err)
+		}
+		c.At = time.UnixMilli(at)
+		changes = append(changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get rating history: %v", err)
+	}
+	return changes, nil
+}
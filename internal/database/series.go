@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Series is the record of a best-of series played in a room by two players.
+type Series struct {
+	ID        int64     `json:"id"`
+	Room      string    `json:"room"`
+	BestOf    int       `json:"bestOf"`
+	StartedAt time.Time `json:"startedAt"`
+	EndedAt   time.Time `json:"endedAt"`
+	Players   [2]string `json:"players"` // ids of player 1 and player 2 of the first game
+	Wins      [2]int    `json:"wins"`    // games won by each of Players
+	Winner    int       `json:"winner"`  // 1 or 2 for the winner among Players, 0 for a draw
+	Reason    string    `json:"reason"`  // why the last game ended, or forfeit if a player left between games
+	Matches   []int64   `json:"matches"` // ids of the stored matches of the series in order
+}
+
+func (s *service) SaveSeries(ctx context.Context, series Series) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO series (room, best_of, started_at, ended_at, player1_id, player2_id, player1_wins, player2_wins, winner, reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		series.Room, series.BestOf, series.StartedAt.UnixMilli(), series.EndedAt.UnixMilli(), series.Players[0], series.Players[1],
+		series.Wins[0], series.Wins[1], series.Winner, series.Reason)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert series: %v", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get series id: %v", err)
+	}
+	for i, match := range series.Matches {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO series_matches (series_id, game, match_id) VALUES (?, ?, ?)`, id, i+1, match); err != nil {
+			return 0, fmt.Errorf("failed to insert series match: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit series: %v", err)
+	}
+	return id, nil
+}
+
+func (s *service) GetSeries(ctx context.Context, id int64) (Series, error) {
+	var series Series
+	var started, ended int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, room, best_of, started_at, ended_at, player1_id, player2_id, player1_wins, player2_wins, winner, reason
+		FROM series WHERE id = ?`, id).Scan(&series.ID, &series.Room, &series.BestOf, &started, &ended,
+		&series.Players[0], &series.Players[1], &series.Wins[0], &series.Wins[1], &series.Winner, &series.Reason)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Series{}, ErrNotFound
+	}
+	if err != nil {
+		return Series{}, fmt.Errorf("failed to get series: %v", err)
+	}
+	series.StartedAt, series.EndedAt = time.UnixMilli(started), time.UnixMilli(ended)
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT match_id FROM series_matches WHERE series_id = ? ORDER BY game`, id)
+	if err != nil {
+		return Series{}, fmt.Errorf("failed to get series matches: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var match int64
+		if err := rows.Scan(&match); err != nil {
+			return Series{}, fmt.Errorf("failed to scan series match: %v", err)
+		}
+		series.Matches = append(series.Matches, match)
+	}
+	if err := rows.Err(); err != nil {
+		return Series{}, fmt.Errorf("failed to get series matches: %v", err)
+	}
+	return series, nil
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"prisoner-fencing/internal/engine"
+)
+
+func TestSaveAndGetSeries(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	start := time.UnixMilli(time.Now().UnixMilli())
+
+	var matches []int64
+	for i := range 3 {
+		id, err := s.SaveMatch(ctx, Match{
+			Room:      "arena",
+			Ruleset:   engine.DefaultRulesetName,
+			StartedAt: start,
+			EndedAt:   start.Add(time.Duration(i) * time.Minute),
+			Winner:    1,
+			Reason:    "elimination",
+			Participants: []Participant{
+				{Seat: 1, PlayerId: "p1"},
+				{Seat: 2, PlayerId: "p2"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to save match: %v", err)
+		}
+		matches = append(matches, id)
+	}
+
+	series := Series{
+		Room:      "arena",
+		BestOf:    3,
+		StartedAt: start,
+		EndedAt:   start.Add(3 * time.Minute),
+		Players:   [2]string{"p1", "p2"},
+		Wins:      [2]int{2, 1},
+		Winner:    1,
+		Reason:    "elimination",
+		Matches:   matches,
+	}
+	id, err := s.SaveSeries(ctx, series)
+	if err != nil {
+		t.Fatalf("failed to save series: %v", err)
+	}
+
+	got, err := s.GetSeries(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to get series: %v", err)
+	}
+	if got.Room != "arena" || got.BestOf != 3 || got.Players != series.Players || got.Wins != series.Wins ||
+		got.Winner != 1 || !got.StartedAt.Equal(start) || !got.EndedAt.Equal(series.EndedAt) {
+		t.Errorf("Expected the saved series back, got %+v", got)
+	}
+	if !slices.Equal(got.Matches, matches) {
+		t.Errorf("Expected matches %v in order, got %v", matches, got.Matches)
+	}
+
+	if _, err := s.GetSeries(ctx, id+1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing series, got %v", err)
+	}
+}
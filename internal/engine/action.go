@@ -0,0 +1,36 @@
+package engine
+
+import "fmt"
+
+// Action is what a player chooses to do in a turn.
+type Action string
+
+// Actions a player can choose each turn.
+const (
+	ActionWait    Action = "WAIT"
+	ActionRetreat Action = "RETREAT"
+	ActionAdvance Action = "ADVANCE"
+	ActionAttack  Action = "ATTACK"
+	ActionCounter Action = "COUNTER"
+)
+
+// Actions lists every action a player can choose.
+var Actions = []Action{ActionWait, ActionRetreat, ActionAdvance, ActionAttack, ActionCounter}
+
+// Valid reports whether a is one of the Actions.
+func (a Action) Valid() bool {
+	switch a {
+	case ActionWait, ActionRetreat, ActionAdvance, ActionAttack, ActionCounter:
+		return true
+	}
+	return false
+}
+
+// ParseAction returns the action named s, such as "ATTACK".
+func ParseAction(s string) (Action, error) {
+	a := Action(s)
+	if !a.Valid() {
+		return "", fmt.Errorf("unknown action: %q", s)
+	}
+	return a, nil
+}
@@ -0,0 +1,35 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+)
+
+// Commitment returns the hex encoded SHA-256 hash of action and nonce that a
+// player publishes before revealing their action. The nonce keeps the five
+// possible actions from being guessed by hashing each of them.
+func Commitment(action Action, nonce string) string {
+	sum := sha256.Sum256([]byte(string(action) + ":" + nonce))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidCommitment reports whether commitment looks like one made by
+// Commitment: 64 lowercase hex digits.
+func ValidCommitment(commitment string) bool {
+	if len(commitment) != 2*sha256.Size {
+		return false
+	}
+	for _, c := range commitment {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyReveal reports whether action and nonce are the ones commitment was
+// made from.
+func VerifyReveal(commitment string, action Action, nonce string) bool {
+	return subtle.ConstantTimeCompare([]byte(Commitment(action, nonce)), []byte(commitment)) == 1
+}
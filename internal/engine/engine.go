@@ -0,0 +1,308 @@
+// Package engine implements the Prisoner Fencing duel rules.
+//
+// It has no knowledge of websockets, rooms or clients: Resolve takes the
+// current State and both players' actions and returns the next State along
+// with structured Outcomes describing what happened during the turn.
+package engine
+
+import "fmt"
+
+// Rule values of the standard ruleset, see DefaultRuleset.
+const (
+	BoardWidth    = 7
+	StartEnergy   = 10
+	MaxTurns      = 20
+	NormalDamage  = 3
+	AdvanceDamage = 6
+)
+
+// Player is the state of a single fencer.
+type Player struct {
+	Pos      int  `json:"pos"`
+	Energy   int  `json:"energy"`
+	Advanced bool `json:"advanced"`
+}
+
+// Priority decides who takes a square both players move into in the same
+// turn.
+type Priority int
+
+const (
+	PriorityPlayer1 Priority = iota
+	PriorityPlayer2
+	PriorityNone // both are blocked
+)
+
+// State is the full state of a duel. Players[0] is player 1, who starts on
+// the left and advances towards higher positions; Players[1] is player 2.
+type State struct {
+	Turn     int       `json:"turn"`
+	MaxTurns int       `json:"maxTurns"`
+	Players  [2]Player `json:"players"`
+	Rules    Ruleset   `json:"rules"`
+	// Priority for the next turn. It is an input to Resolve, and the caller
+	// decides how it is chosen.
+	Priority Priority `json:"priority"`
+}
+
+// NewState returns the state of a fresh duel played under rules.
+func NewState(rules Ruleset) State {
+	return State{
+		MaxTurns: rules.MaxTurns,
+		Players: [2]Player{
+			{Pos: rules.StartPos[0], Energy: rules.StartEnergy},
+			{Pos: rules.StartPos[1], Energy: rules.StartEnergy},
+		},
+		Rules: rules,
+	}
+}
+
+// OutcomeKind identifies what an Outcome describes.
+type OutcomeKind string
+
+const (
+	OutcomeRest      OutcomeKind = "rest"      // WAIT restored energy
+	OutcomeRetreat   OutcomeKind = "retreat"   // moved away from the opponent
+	OutcomeAdvance   OutcomeKind = "advance"   // moved towards the opponent
+	OutcomeBlocked   OutcomeKind = "blocked"   // movement was blocked by the opponent
+	OutcomeContested OutcomeKind = "contested" // lost a square both players moved into
+	OutcomeHit       OutcomeKind = "hit"       // attack landed on the opponent
+	OutcomeMiss      OutcomeKind = "miss"      // attack missed
+	OutcomeReflected OutcomeKind = "reflected" // attack was countered back onto the attacker
+	OutcomePenalty   OutcomeKind = "penalty"   // counter with nothing to counter
+	OutcomeClash     OutcomeKind = "clash"     // both attacked, only the stronger attack's surplus lands
+)
+
+// Outcome describes one thing that happened to a player during a turn.
+type Outcome struct {
+	Player  int         `json:"player"` // 1 or 2, the player whose action caused it
+	Action  Action      `json:"action"`
+	Kind    OutcomeKind `json:"kind"`
+	Amount  int         `json:"amount,omitempty"` // energy gained, spent or dealt
+	Message string      `json:"message"`
+}
+
+// Result is the verdict on a State.
+type Result struct {
+	Over     bool `json:"over"`
+	Winner   int  `json:"winner"`   // 1 or 2, 0 for a draw
+	ByEnergy bool `json:"byEnergy"` // decided on energy after the last turn
+	Forfeit  bool `json:"forfeit"`  // the loser abandoned the duel
+}
+
+// Forfeit returns the result of a duel abandoned by player loser.
+func Forfeit(loser int) Result {
+	return Result{Over: true, Winner: 3 - loser, Forfeit: true}
+}
+
+// Resolve plays one turn in which player 1 chose a and player 2 chose b. The
+// given state is not modified. Both actions must be valid.
+func Resolve(s State, a, b Action) (State, []Outcome) {
+	actions := [2]Action{a, b}
+	var outcomes []Outcome
+
+	// Simultaneous movement resolution
+	var intended [2]int
+	for i := range s.Players {
+		var o *Outcome
+		intended[i], o = resolveIntendedMovement(&s.Players[i], i, actions[i], s.Rules)
+		if o != nil {
+			outcomes = append(outcomes, *o)
+		}
+	}
+	pos1, pos2 := resolveSimultaneousMovement(s.Players[0].Pos, intended[0], s.Players[1].Pos, intended[1], s.Priority)
+	contested := intended[0] == intended[1] && intended[0] != s.Players[0].Pos && intended[1] != s.Players[1].Pos
+	for i, pos := range [2]int{pos1, pos2} {
+		if pos != intended[i] {
+			o := Outcome{
+				Player:  i + 1,
+				Action:  actions[i],
+				Kind:    OutcomeBlocked,
+				Message: "Blocked by opponent.",
+			}
+			if contested {
+				o.Kind, o.Message = OutcomeContested, "Lost the contested square."
+			}
+			outcomes = append(outcomes, o)
+		}
+		s.Players[i].Pos = pos
+	}
+
+	// Then resolve combat for both players. Attack strength is fixed before
+	// either side resolves, since resolving clears the Advanced flag.
+	damage := [2]int{attackDamage(s.Players[0], s.Rules), attackDamage(s.Players[1], s.Rules)}
+	for i := range s.Players {
+		o := resolveCombat(&s.Players[i], &s.Players[1-i], i, actions[i], actions[1-i], damage[i], damage[1-i], s.Rules)
+		if o != nil {
+			outcomes = append(outcomes, *o)
+		}
+	}
+
+	s.Turn++
+	return s, outcomes
+}
+
+// Result reports whether the duel is over and who won.
+func (s State) Result() Result {
+	e1, e2 := s.Players[0].Energy, s.Players[1].Energy
+	switch {
+	case e1 > 0 && e2 <= 0:
+		return Result{Over: true, Winner: 1}
+	case e1 <= 0 && e2 > 0:
+		return Result{Over: true, Winner: 2}
+	case e1 <= 0 && e2 <= 0:
+		return Result{Over: true}
+	case s.Turn > s.MaxTurns:
+		r := Result{Over: true, ByEnergy: true}
+		if e1 > e2 {
+			r.Winner = 1
+		} else if e2 > e1 {
+			r.Winner = 2
+		}
+		return r
+	}
+	return Result{}
+}
+
+// towards returns the step direction for the player at index side when
+// moving towards the opponent.
+func towards(side int) int {
+	if side == 0 {
+		return 1
+	}
+	return -1
+}
+
+// Movement actions: WAIT, RETREAT, ADVANCE
+// Applies the energy cost and returns the intended new position.
+func resolveIntendedMovement(p *Player, side int, action Action, rules Ruleset) (int, *Outcome) {
+	o := &Outcome{Player: side + 1, Action: action}
+	switch action {
+	case ActionWait:
+		p.Energy += rules.WaitGain
+		o.Kind, o.Amount, o.Message = OutcomeRest, rules.WaitGain, fmt.Sprintf("WAIT: +%d Energy", rules.WaitGain)
+		return p.Pos, o
+	case ActionRetreat:
+		p.Energy -= rules.RetreatCost
+		o.Kind, o.Amount, o.Message = OutcomeRetreat, rules.RetreatCost, fmt.Sprintf("RETREAT: -%d Energy", rules.RetreatCost)
+		return clamp(p.Pos-towards(side), 0, rules.BoardWidth-1), o
+	case ActionAdvance:
+		p.Energy -= rules.AdvanceCost
+		p.Advanced = true
+		o.Kind, o.Amount, o.Message = OutcomeAdvance, rules.AdvanceCost, "ADVANCE: Double attack next turn"
+		return clamp(p.Pos+towards(side), 0, rules.BoardWidth-1), o
+	}
+	return p.Pos, nil
+}
+
+// attackDamage returns the damage an attack by p deals this turn.
+func attackDamage(p Player, rules Ruleset) int {
+	if p.Advanced {
+		return rules.AdvanceDamage
+	}
+	return rules.NormalDamage
+}
+
+// Combat actions: ATTACK, COUNTER
+func resolveCombat(p1, p2 *Player, side int, action, opponentAction Action, dmg, opponentDmg int, rules Ruleset) *Outcome {
+	var o *Outcome
+	adjacent := abs(p1.Pos-p2.Pos) == 1
+
+	switch action {
+	case ActionAttack:
+		o = &Outcome{Player: side + 1, Action: action}
+		switch opponentAction {
+		case ActionAttack:
+			// Clash: equal attacks cancel out, a stronger one deals the difference
+			if !adjacent {
+				p1.Energy -= rules.MissCost
+				o.Kind, o.Amount = OutcomeMiss, rules.MissCost
+				o.Message = "Attack missed! Not adjacent."
+			} else if dmg > opponentDmg {
+				p2.Energy -= dmg - opponentDmg
+				o.Kind, o.Amount = OutcomeClash, dmg-opponentDmg
+				o.Message = fmt.Sprintf("Clash! Stronger attack deals %d damage.", dmg-opponentDmg)
+			} else if dmg < opponentDmg {
+				o.Kind = OutcomeClash
+				o.Message = "Clash! Overpowered."
+			} else {
+				o.Kind = OutcomeClash
+				o.Message = "Clash! Attacks cancel out."
+			}
+		case ActionCounter:
+			if adjacent {
+				p1.Energy -= dmg
+				o.Kind, o.Amount = OutcomeReflected, dmg
+				o.Message = fmt.Sprintf("Opponent countered! takes %d damage.", dmg)
+			} else {
+				p1.Energy -= rules.MissCost
+				o.Kind, o.Amount = OutcomeMiss, rules.MissCost
+				o.Message = "Countered, but not adjacent. No damage."
+			}
+		case ActionRetreat:
+			p1.Energy -= rules.MissCost
+			o.Kind, o.Amount = OutcomeMiss, rules.MissCost
+			o.Message = "Attack missed! Opponent retreated."
+		default:
+			if adjacent {
+				p2.Energy -= dmg
+				o.Kind, o.Amount = OutcomeHit, dmg
+				o.Message = fmt.Sprintf("Attacked for %d damage.", dmg)
+			} else {
+				p1.Energy -= rules.MissCost
+				o.Kind, o.Amount = OutcomeMiss, rules.MissCost
+				o.Message = "Attack missed! Not adjacent."
+			}
+		}
+	case ActionCounter:
+		if opponentAction != ActionAttack || !adjacent {
+			p1.Energy -= rules.CounterPenalty
+			o = &Outcome{Player: side + 1, Action: action, Kind: OutcomePenalty, Amount: rules.CounterPenalty, Message: fmt.Sprintf("Countered nothing. -%d Energy.", rules.CounterPenalty)}
+		}
+	}
+	if action != ActionAdvance {
+		p1.Advanced = false
+	}
+	return o
+}
+
+// resolveSimultaneousMovement applies blocking, swap, and priority rules and returns new positions for both players
+func resolveSimultaneousMovement(pos1, intended1, pos2, intended2 int, priority Priority) (newPos1, newPos2 int) {
+	// Swap places: both blocked
+	if intended1 == pos2 && intended2 == pos1 {
+		return pos1, pos2
+	}
+	// Both try to move to same square (not their current): priority decides
+	if intended1 == intended2 && intended1 != pos1 && intended2 != pos2 {
+		switch priority {
+		case PriorityPlayer2:
+			return pos1, intended2
+		case PriorityNone:
+			return pos1, pos2
+		}
+		return intended1, pos2
+	}
+	// p1 blocked by p2
+	if intended1 == pos2 && intended2 == pos2 {
+		return pos1, intended2
+	}
+	// p2 blocked by p1
+	if intended2 == pos1 && intended1 == pos1 {
+		return intended1, pos2
+	}
+	// Otherwise, both move
+	return intended1, intended2
+}
+
+// clamp limits x to the range [lo, hi]
+func clamp(x, lo, hi int) int {
+	return max(lo, min(hi, x))
+}
+
+// abs returns the absolute value of an integer
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,508 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+// newTestState returns a state with both players at full energy on the given squares.
+func newTestState(pos1, pos2 int) State {
+	s := NewState(DefaultRuleset())
+	s.Turn = 1
+	s.Players[0].Pos = pos1
+	s.Players[1].Pos = pos2
+	return s
+}
+
+func TestAdvanceDoubleAttack(t *testing.T) {
+	s := newTestState(2, 4)
+
+	// Both try to move to same square (3), p1 gets priority
+	s, _ = Resolve(s, ActionAdvance, ActionAdvance)
+	p1, p2 := s.Players[0], s.Players[1]
+	if p1.Energy != 9 {
+		t.Errorf("Expected p1 energy to be 9 after advance, got %d", p1.Energy)
+	}
+	if p1.Pos != 3 || p2.Pos != 4 {
+		t.Errorf("Expected positions 3 and 4 after contested advance, got %d and %d", p1.Pos, p2.Pos)
+	}
+
+	// Next turn: p1 attacks, p2 waits
+	s, _ = Resolve(s, ActionAttack, ActionWait)
+	p1, p2 = s.Players[0], s.Players[1]
+	if p2.Energy != 4 {
+		t.Errorf("Expected p2 energy to be 4 after double attack, got %d", p2.Energy)
+	}
+	if p1.Advanced {
+		t.Errorf("Advanced should reset after attack")
+	}
+}
+
+func TestCounterReflect(t *testing.T) {
+	s, outcomes := Resolve(newTestState(3, 4), ActionAttack, ActionCounter)
+
+	if s.Players[0].Energy != 7 {
+		t.Errorf("Expected p1 energy to be 7 after counter reflect, got %d", s.Players[0].Energy)
+	}
+	if s.Players[1].Energy != 10 {
+		t.Errorf("Expected p2 energy to be 10 after counter reflect, got %d", s.Players[1].Energy)
+	}
+	if len(outcomes) != 1 || outcomes[0].Kind != OutcomeReflected || outcomes[0].Player != 1 {
+		t.Errorf("Expected a single reflected outcome for p1, got %+v", outcomes)
+	}
+}
+
+func TestCounterPenalty(t *testing.T) {
+	s, _ := Resolve(newTestState(2, 4), ActionCounter, ActionWait)
+
+	if s.Players[0].Energy != 8 {
+		t.Errorf("Expected p1 energy to be 8 after counter penalty, got %d", s.Players[0].Energy)
+	}
+}
+
+func TestWaitEnergy(t *testing.T) {
+	s, _ := Resolve(newTestState(2, 4), ActionWait, ActionWait)
+	if s.Players[1].Energy != 11 {
+		t.Errorf("Expected p2 energy to be 11 after WAIT, got %d", s.Players[1].Energy)
+	}
+
+	s, _ = Resolve(s, ActionWait, ActionCounter)
+	if s.Players[0].Energy != 12 {
+		t.Errorf("Expected p1 energy to be 12 after WAIT twice, got %d", s.Players[0].Energy)
+	}
+}
+
+func TestRetreatAdvanceEnergy(t *testing.T) {
+	s, _ := Resolve(newTestState(2, 4), ActionRetreat, ActionAdvance)
+	p1, p2 := s.Players[0], s.Players[1]
+
+	if p1.Energy != 9 {
+		t.Errorf("Expected p1 energy to be 9 after RETREAT, got %d", p1.Energy)
+	}
+	if p2.Energy != 9 {
+		t.Errorf("Expected p2 energy to be 9 after ADVANCE, got %d", p2.Energy)
+	}
+	if !p2.Advanced {
+		t.Errorf("Expected p2.Advanced to be true after ADVANCE")
+	}
+	if p1.Pos != 1 || p2.Pos != 3 {
+		t.Errorf("Expected positions 1 and 3, got %d and %d", p1.Pos, p2.Pos)
+	}
+}
+
+func TestAttackAdjacentHit(t *testing.T) {
+	s, _ := Resolve(newTestState(2, 3), ActionAttack, ActionWait)
+
+	if s.Players[1].Energy != 8 {
+		t.Errorf("Expected p2 energy to be 8 after adjacent attack, got %d", s.Players[1].Energy)
+	}
+}
+
+func TestAttackNotAdjacentMiss(t *testing.T) {
+	s, _ := Resolve(newTestState(2, 4), ActionAttack, ActionWait)
+
+	if s.Players[1].Energy != 11 {
+		t.Errorf("Expected p2 energy to be 11 after non-adjacent attack, got %d", s.Players[1].Energy)
+	}
+	if s.Players[0].Energy != 9 {
+		t.Errorf("Expected p1 energy to be 9 after missed attack, got %d", s.Players[0].Energy)
+	}
+}
+
+func TestAttackMissOnRetreat(t *testing.T) {
+	s, _ := Resolve(newTestState(2, 3), ActionAttack, ActionRetreat)
+
+	if s.Players[1].Energy != 9 {
+		t.Errorf("Expected p2 energy to be 9 after retreat, got %d", s.Players[1].Energy)
+	}
+	if s.Players[0].Energy != 9 {
+		t.Errorf("Expected p1 energy to be 9 after missed attack on retreat, got %d", s.Players[0].Energy)
+	}
+}
+
+func TestCounterOnlyIfAdjacent(t *testing.T) {
+	s, _ := Resolve(newTestState(2, 4), ActionAttack, ActionCounter)
+
+	if s.Players[0].Energy != 9 {
+		t.Errorf("Expected p1 energy to be 9 after non-adjacent counter, got %d", s.Players[0].Energy)
+	}
+	if s.Players[1].Energy != 8 {
+		t.Errorf("Expected p2 energy to be 8 after non-adjacent counter, got %d", s.Players[1].Energy)
+	}
+}
+
+func TestResolveDoesNotModifyInput(t *testing.T) {
+	s := newTestState(2, 3)
+	next, _ := Resolve(s, ActionAttack, ActionAdvance)
+
+	if s != newTestState(2, 3) {
+		t.Errorf("Expected input state to be unchanged, got %+v", s)
+	}
+	if next.Turn != s.Turn+1 {
+		t.Errorf("Expected turn to be %d, got %d", s.Turn+1, next.Turn)
+	}
+}
+
+func TestResult(t *testing.T) {
+	s := NewState(DefaultRuleset())
+	if r := s.Result(); r.Over {
+		t.Errorf("Expected fresh game not to be over, got %+v", r)
+	}
+
+	s.Players[1].Energy = 0
+	if r := s.Result(); !r.Over || r.Winner != 1 || r.ByEnergy {
+		t.Errorf("Expected p1 to win by elimination, got %+v", r)
+	}
+
+	s = NewState(DefaultRuleset())
+	s.Turn = s.MaxTurns + 1
+	s.Players[1].Energy = 12
+	if r := s.Result(); !r.Over || r.Winner != 2 || !r.ByEnergy {
+		t.Errorf("Expected p2 to win by energy, got %+v", r)
+	}
+}
+
+func TestValidCommitment(t *testing.T) {
+	tests := []struct {
+		commitment string
+		valid      bool
+	}{
+		{Commitment(ActionWait, "n1"), true},
+		{"", false},
+		{"abc", false},
+		{strings.ToUpper(Commitment(ActionWait, "n1")), false},
+		{strings.Repeat("g", 64), false},
+		{Commitment(ActionWait, "n1") + "0", false},
+	}
+	for _, tt := range tests {
+		if got := ValidCommitment(tt.commitment); got != tt.valid {
+			t.Errorf("ValidCommitment(%q) = %v, expected %v", tt.commitment, got, tt.valid)
+		}
+	}
+}
+
+func TestVerifyReveal(t *testing.T) {
+	commitment := Commitment(ActionAttack, "s3cret")
+
+	if !VerifyReveal(commitment, ActionAttack, "s3cret") {
+		t.Errorf("Expected reveal with the committed action and nonce to verify")
+	}
+	if VerifyReveal(commitment, ActionCounter, "s3cret") {
+		t.Errorf("Expected reveal with a different action to fail")
+	}
+	if VerifyReveal(commitment, ActionAttack, "guess") {
+		t.Errorf("Expected reveal with a different nonce to fail")
+	}
+}
+
+// TestCombatTable covers every pairing of actions, with and without the
+// Advanced bonus, starting adjacent (squares 2 and 3) or apart (1 and 4).
+func TestCombatTable(t *testing.T) {
+	tests := []struct {
+		a, b         Action
+		adv1, adv2   bool
+		adjacent     bool
+		want1, want2 int
+	}{
+		{ActionWait, ActionWait, false, false, true, 11, 11},
+		{ActionWait, ActionWait, false, true, true, 11, 11},
+		{ActionWait, ActionWait, true, false, true, 11, 11},
+		{ActionWait, ActionWait, true, true, true, 11, 11},
+		{ActionWait, ActionRetreat, false, false, true, 11, 9},
+		{ActionWait, ActionRetreat, false, true, true, 11, 9},
+		{ActionWait, ActionRetreat, true, false, true, 11, 9},
+		{ActionWait, ActionRetreat, true, true, true, 11, 9},
+		{ActionWait, ActionAdvance, false, false, true, 11, 9},
+		{ActionWait, ActionAdvance, false, true, true, 11, 9},
+		{ActionWait, ActionAdvance, true, false, true, 11, 9},
+		{ActionWait, ActionAdvance, true, true, true, 11, 9},
+		{ActionWait, ActionAttack, false, false, true, 8, 10},
+		{ActionWait, ActionAttack, false, true, true, 5, 10},
+		{ActionWait, ActionAttack, true, false, true, 8, 10},
+		{ActionWait, ActionAttack, true, true, true, 5, 10},
+		{ActionWait, ActionCounter, false, false, true, 11, 8},
+		{ActionWait, ActionCounter, false, true, true, 11, 8},
+		{ActionWait, ActionCounter, true, false, true, 11, 8},
+		{ActionWait, ActionCounter, true, true, true, 11, 8},
+		{ActionRetreat, ActionWait, false, false, true, 9, 11},
+		{ActionRetreat, ActionWait, false, true, true, 9, 11},
+		{ActionRetreat, ActionWait, true, false, true, 9, 11},
+		{ActionRetreat, ActionWait, true, true, true, 9, 11},
+		{ActionRetreat, ActionRetreat, false, false, true, 9, 9},
+		{ActionRetreat, ActionRetreat, false, true, true, 9, 9},
+		{ActionRetreat, ActionRetreat, true, false, true, 9, 9},
+		{ActionRetreat, ActionRetreat, true, true, true, 9, 9},
+		{ActionRetreat, ActionAdvance, false, false, true, 9, 9},
+		{ActionRetreat, ActionAdvance, false, true, true, 9, 9},
+		{ActionRetreat, ActionAdvance, true, false, true, 9, 9},
+		{ActionRetreat, ActionAdvance, true, true, true, 9, 9},
+		{ActionRetreat, ActionAttack, false, false, true, 9, 9},
+		{ActionRetreat, ActionAttack, false, true, true, 9, 9},
+		{ActionRetreat, ActionAttack, true, false, true, 9, 9},
+		{ActionRetreat, ActionAttack, true, true, true, 9, 9},
+		{ActionRetreat, ActionCounter, false, false, true, 9, 8},
+		{ActionRetreat, ActionCounter, false, true, true, 9, 8},
+		{ActionRetreat, ActionCounter, true, false, true, 9, 8},
+		{ActionRetreat, ActionCounter, true, true, true, 9, 8},
+		{ActionAdvance, ActionWait, false, false, true, 9, 11},
+		{ActionAdvance, ActionWait, false, true, true, 9, 11},
+		{ActionAdvance, ActionWait, true, false, true, 9, 11},
+		{ActionAdvance, ActionWait, true, true, true, 9, 11},
+		{ActionAdvance, ActionRetreat, false, false, true, 9, 9},
+		{ActionAdvance, ActionRetreat, false, true, true, 9, 9},
+		{ActionAdvance, ActionRetreat, true, false, true, 9, 9},
+		{ActionAdvance, ActionRetreat, true, true, true, 9, 9},
+		{ActionAdvance, ActionAdvance, false, false, true, 9, 9},
+		{ActionAdvance, ActionAdvance, false, true, true, 9, 9},
+		{ActionAdvance, ActionAdvance, true, false, true, 9, 9},
+		{ActionAdvance, ActionAdvance, true, true, true, 9, 9},
+		{ActionAdvance, ActionAttack, false, false, true, 6, 10},
+		{ActionAdvance, ActionAttack, false, true, true, 3, 10},
+		{ActionAdvance, ActionAttack, true, false, true, 6, 10},
+		{ActionAdvance, ActionAttack, true, true, true, 3, 10},
+		{ActionAdvance, ActionCounter, false, false, true, 9, 8},
+		{ActionAdvance, ActionCounter, false, true, true, 9, 8},
+		{ActionAdvance, ActionCounter, true, false, true, 9, 8},
+		{ActionAdvance, ActionCounter, true, true, true, 9, 8},
+		{ActionAttack, ActionWait, false, false, true, 10, 8},
+		{ActionAttack, ActionWait, false, true, true, 10, 8},
+		{ActionAttack, ActionWait, true, false, true, 10, 5},
+		{ActionAttack, ActionWait, true, true, true, 10, 5},
+		{ActionAttack, ActionRetreat, false, false, true, 9, 9},
+		{ActionAttack, ActionRetreat, false, true, true, 9, 9},
+		{ActionAttack, ActionRetreat, true, false, true, 9, 9},
+		{ActionAttack, ActionRetreat, true, true, true, 9, 9},
+		{ActionAttack, ActionAdvance, false, false, true, 10, 6},
+		{ActionAttack, ActionAdvance, false, true, true, 10, 6},
+		{ActionAttack, ActionAdvance, true, false, true, 10, 3},
+		{ActionAttack, ActionAdvance, true, true, true, 10, 3},
+		{ActionAttack, ActionAttack, false, false, true, 10, 10},
+		{ActionAttack, ActionAttack, false, true, true, 7, 10},
+		{ActionAttack, ActionAttack, true, false, true, 10, 7},
+		{ActionAttack, ActionAttack, true, true, true, 10, 10},
+		{ActionAttack, ActionCounter, false, false, true, 7, 10},
+		{ActionAttack, ActionCounter, false, true, true, 7, 10},
+		{ActionAttack, ActionCounter, true, false, true, 4, 10},
+		{ActionAttack, ActionCounter, true, true, true, 4, 10},
+		{ActionCounter, ActionWait, false, false, true, 8, 11},
+		{ActionCounter, ActionWait, false, true, true, 8, 11},
+		{ActionCounter, ActionWait, true, false, true, 8, 11},
+		{ActionCounter, ActionWait, true, true, true, 8, 11},
+		{ActionCounter, ActionRetreat, false, false, true, 8, 9},
+		{ActionCounter, ActionRetreat, false, true, true, 8, 9},
+		{ActionCounter, ActionRetreat, true, false, true, 8, 9},
+		{ActionCounter, ActionRetreat, true, true, true, 8, 9},
+		{ActionCounter, ActionAdvance, false, false, true, 8, 9},
+		{ActionCounter, ActionAdvance, false, true, true, 8, 9},
+		{ActionCounter, ActionAdvance, true, false, true, 8, 9},
+		{ActionCounter, ActionAdvance, true, true, true, 8, 9},
+		{ActionCounter, ActionAttack, false, false, true, 10, 7},
+		{ActionCounter, ActionAttack, false, true, true, 10, 4},
+		{ActionCounter, ActionAttack, true, false, true, 10, 7},
+		{ActionCounter, ActionAttack, true, true, true, 10, 4},
+		{ActionCounter, ActionCounter, false, false, true, 8, 8},
+		{ActionCounter, ActionCounter, false, true, true, 8, 8},
+		{ActionCounter, ActionCounter, true, false, true, 8, 8},
+		{ActionCounter, ActionCounter, true, true, true, 8, 8},
+		{ActionWait, ActionWait, false, false, false, 11, 11},
+		{ActionWait, ActionWait, false, true, false, 11, 11},
+		{ActionWait, ActionWait, true, false, false, 11, 11},
+		{ActionWait, ActionWait, true, true, false, 11, 11},
+		{ActionWait, ActionRetreat, false, false, false, 11, 9},
+		{ActionWait, ActionRetreat, false, true, false, 11, 9},
+		{ActionWait, ActionRetreat, true, false, false, 11, 9},
+		{ActionWait, ActionRetreat, true, true, false, 11, 9},
+		{ActionWait, ActionAdvance, false, false, false, 11, 9},
+		{ActionWait, ActionAdvance, false, true, false, 11, 9},
+		{ActionWait, ActionAdvance, true, false, false, 11, 9},
+		{ActionWait, ActionAdvance, true, true, false, 11, 9},
+		{ActionWait, ActionAttack, false, false, false, 11, 9},
+		{ActionWait, ActionAttack, false, true, false, 11, 9},
+		{ActionWait, ActionAttack, true, false, false, 11, 9},
+		{ActionWait, ActionAttack, true, true, false, 11, 9},
+		{ActionWait, ActionCounter, false, false, false, 11, 8},
+		{ActionWait, ActionCounter, false, true, false, 11, 8},
+		{ActionWait, ActionCounter, true, false, false, 11, 8},
+		{ActionWait, ActionCounter, true, true, false, 11, 8},
+		{ActionRetreat, ActionWait, false, false, false, 9, 11},
+		{ActionRetreat, ActionWait, false, true, false, 9, 11},
+		{ActionRetreat, ActionWait, true, false, false, 9, 11},
+		{ActionRetreat, ActionWait, true, true, false, 9, 11},
+		{ActionRetreat, ActionRetreat, false, false, false, 9, 9},
+		{ActionRetreat, ActionRetreat, false, true, false, 9, 9},
+		{ActionRetreat, ActionRetreat, true, false, false, 9, 9},
+		{ActionRetreat, ActionRetreat, true, true, false, 9, 9},
+		{ActionRetreat, ActionAdvance, false, false, false, 9, 9},
+		{ActionRetreat, ActionAdvance, false, true, false, 9, 9},
+		{ActionRetreat, ActionAdvance, true, false, false, 9, 9},
+		{ActionRetreat, ActionAdvance, true, true, false, 9, 9},
+		{ActionRetreat, ActionAttack, false, false, false, 9, 9},
+		{ActionRetreat, ActionAttack, false, true, false, 9, 9},
+		{ActionRetreat, ActionAttack, true, false, false, 9, 9},
+		{ActionRetreat, ActionAttack, true, true, false, 9, 9},
+		{ActionRetreat, ActionCounter, false, false, false, 9, 8},
+		{ActionRetreat, ActionCounter, false, true, false, 9, 8},
+		{ActionRetreat, ActionCounter, true, false, false, 9, 8},
+		{ActionRetreat, ActionCounter, true, true, false, 9, 8},
+		{ActionAdvance, ActionWait, false, false, false, 9, 11},
+		{ActionAdvance, ActionWait, false, true, false, 9, 11},
+		{ActionAdvance, ActionWait, true, false, false, 9, 11},
+		{ActionAdvance, ActionWait, true, true, false, 9, 11},
+		{ActionAdvance, ActionRetreat, false, false, false, 9, 9},
+		{ActionAdvance, ActionRetreat, false, true, false, 9, 9},
+		{ActionAdvance, ActionRetreat, true, false, false, 9, 9},
+		{ActionAdvance, ActionRetreat, true, true, false, 9, 9},
+		{ActionAdvance, ActionAdvance, false, false, false, 9, 9},
+		{ActionAdvance, ActionAdvance, false, true, false, 9, 9},
+		{ActionAdvance, ActionAdvance, true, false, false, 9, 9},
+		{ActionAdvance, ActionAdvance, true, true, false, 9, 9},
+		{ActionAdvance, ActionAttack, false, false, false, 9, 9},
+		{ActionAdvance, ActionAttack, false, true, false, 9, 9},
+		{ActionAdvance, ActionAttack, true, false, false, 9, 9},
+		{ActionAdvance, ActionAttack, true, true, false, 9, 9},
+		{ActionAdvance, ActionCounter, false, false, false, 9, 8},
+		{ActionAdvance, ActionCounter, false, true, false, 9, 8},
+		{ActionAdvance, ActionCounter, true, false, false, 9, 8},
+		{ActionAdvance, ActionCounter, true, true, false, 9, 8},
+		{ActionAttack, ActionWait, false, false, false, 9, 11},
+		{ActionAttack, ActionWait, false, true, false, 9, 11},
+		{ActionAttack, ActionWait, true, false, false, 9, 11},
+		{ActionAttack, ActionWait, true, true, false, 9, 11},
+		{ActionAttack, ActionRetreat, false, false, false, 9, 9},
+		{ActionAttack, ActionRetreat, false, true, false, 9, 9},
+		{ActionAttack, ActionRetreat, true, false, false, 9, 9},
+		{ActionAttack, ActionRetreat, true, true, false, 9, 9},
+		{ActionAttack, ActionAdvance, false, false, false, 9, 9},
+		{ActionAttack, ActionAdvance, false, true, false, 9, 9},
+		{ActionAttack, ActionAdvance, true, false, false, 9, 9},
+		{ActionAttack, ActionAdvance, true, true, false, 9, 9},
+		{ActionAttack, ActionAttack, false, false, false, 9, 9},
+		{ActionAttack, ActionAttack, false, true, false, 9, 9},
+		{ActionAttack, ActionAttack, true, false, false, 9, 9},
+		{ActionAttack, ActionAttack, true, true, false, 9, 9},
+		{ActionAttack, ActionCounter, false, false, false, 9, 8},
+		{ActionAttack, ActionCounter, false, true, false, 9, 8},
+		{ActionAttack, ActionCounter, true, false, false, 9, 8},
+		{ActionAttack, ActionCounter, true, true, false, 9, 8},
+		{ActionCounter, ActionWait, false, false, false, 8, 11},
+		{ActionCounter, ActionWait, false, true, false, 8, 11},
+		{ActionCounter, ActionWait, true, false, false, 8, 11},
+		{ActionCounter, ActionWait, true, true, false, 8, 11},
+		{ActionCounter, ActionRetreat, false, false, false, 8, 9},
+		{ActionCounter, ActionRetreat, false, true, false, 8, 9},
+		{ActionCounter, ActionRetreat, true, false, false, 8, 9},
+		{ActionCounter, ActionRetreat, true, true, false, 8, 9},
+		{ActionCounter, ActionAdvance, false, false, false, 8, 9},
+		{ActionCounter, ActionAdvance, false, true, false, 8, 9},
+		{ActionCounter, ActionAdvance, true, false, false, 8, 9},
+		{ActionCounter, ActionAdvance, true, true, false, 8, 9},
+		{ActionCounter, ActionAttack, false, false, false, 8, 9},
+		{ActionCounter, ActionAttack, false, true, false, 8, 9},
+		{ActionCounter, ActionAttack, true, false, false, 8, 9},
+		{ActionCounter, ActionAttack, true, true, false, 8, 9},
+		{ActionCounter, ActionCounter, false, false, false, 8, 8},
+		{ActionCounter, ActionCounter, false, true, false, 8, 8},
+		{ActionCounter, ActionCounter, true, false, false, 8, 8},
+		{ActionCounter, ActionCounter, true, true, false, 8, 8},
+	}
+
+	for _, tt := range tests {
+		s := newTestState(1, 4)
+		if tt.adjacent {
+			s = newTestState(2, 3)
+		}
+		s.Players[0].Advanced = tt.adv1
+		s.Players[1].Advanced = tt.adv2
+
+		next, _ := Resolve(s, tt.a, tt.b)
+		if next.Players[0].Energy != tt.want1 || next.Players[1].Energy != tt.want2 {
+			t.Errorf("%s (advanced %v) vs %s (advanced %v), adjacent %v: expected energy %d/%d, got %d/%d",
+				tt.a, tt.adv1, tt.b, tt.adv2, tt.adjacent, tt.want1, tt.want2, next.Players[0].Energy, next.Players[1].Energy)
+		}
+	}
+}
+
+func TestAttackClash(t *testing.T) {
+	s := newTestState(2, 3)
+	s.Players[1].Advanced = true
+	next, outcomes := Resolve(s, ActionAttack, ActionAttack)
+
+	if next.Players[0].Energy != 7 || next.Players[1].Energy != 10 {
+		t.Errorf("Expected advanced attack to deal 3 through the clash, got energy %d/%d", next.Players[0].Energy, next.Players[1].Energy)
+	}
+	for _, o := range outcomes {
+		if o.Kind != OutcomeClash {
+			t.Errorf("Expected only clash outcomes, got %+v", o)
+		}
+	}
+}
+
+func TestContestedSquarePriority(t *testing.T) {
+	tests := []struct {
+		priority   Priority
+		pos1, pos2 int
+	}{
+		{PriorityPlayer1, 3, 4},
+		{PriorityPlayer2, 2, 3},
+		{PriorityNone, 2, 4},
+	}
+
+	for _, tt := range tests {
+		s := newTestState(2, 4)
+		s.Priority = tt.priority
+		next, outcomes := Resolve(s, ActionAdvance, ActionAdvance)
+
+		if next.Players[0].Pos != tt.pos1 || next.Players[1].Pos != tt.pos2 {
+			t.Errorf("Priority %d: expected positions %d and %d, got %d and %d", tt.priority, tt.pos1, tt.pos2, next.Players[0].Pos, next.Players[1].Pos)
+		}
+		for _, o := range outcomes {
+			if o.Kind == OutcomeBlocked {
+				t.Errorf("Priority %d: expected contested outcomes rather than blocked, got %+v", tt.priority, o)
+			}
+		}
+	}
+}
+
+func TestResolveUsesRuleset(t *testing.T) {
+	rules := DefaultRuleset()
+	rules.BoardWidth = 11
+	rules.WaitGain = 0
+	rules.MissCost = 2
+	s := NewState(rules)
+	s.Players[0].Pos, s.Players[1].Pos = 0, 10
+
+	s, _ = Resolve(s, ActionRetreat, ActionRetreat)
+	if s.Players[0].Pos != 0 || s.Players[1].Pos != 10 {
+		t.Errorf("Expected players to stay on the edges of an 11 square board, got %d and %d", s.Players[0].Pos, s.Players[1].Pos)
+	}
+
+	s, _ = Resolve(s, ActionAttack, ActionWait)
+	if s.Players[0].Energy != 7 || s.Players[1].Energy != 9 {
+		t.Errorf("Expected energies 7 and 9 under the ruleset costs, got %d and %d", s.Players[0].Energy, s.Players[1].Energy)
+	}
+}
+
+func TestRulesetValidate(t *testing.T) {
+	if err := DefaultRuleset().Validate(); err != nil {
+		t.Errorf("Expected the default ruleset to be valid, got %v", err)
+	}
+
+	bad := DefaultRuleset()
+	bad.StartPos = [2]int{4, 2}
+	if err := bad.Validate(); err == nil {
+		t.Errorf("Expected swapped start positions to be rejected")
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	for _, a := range Actions {
+		if got, err := ParseAction(string(a)); err != nil || got != a {
+			t.Errorf("ParseAction(%q) = %q, %v", a, got, err)
+		}
+	}
+	for _, s := range []string{"", "FLY", "wait", " WAIT"} {
+		if _, err := ParseAction(s); err == nil {
+			t.Errorf("Expected ParseAction(%q) to fail", s)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DefaultRulesetName is the name of the ruleset returned by DefaultRuleset.
+const DefaultRulesetName = "standard"
+
+// Ruleset holds the tunable numbers of a duel. Variants such as a longer
+// board or sudden death are rulesets with different values.
+type Ruleset struct {
+	Name          string `json:"name"`
+	BoardWidth    int    `json:"boardWidth"`
+	StartPos      [2]int `json:"startPos"` // squares of player 1 and player 2
+	StartEnergy   int    `json:"startEnergy"`
+	MaxTurns      int    `json:"maxTurns"`
+	NormalDamage  int    `json:"normalDamage"`
+	AdvanceDamage int    `json:"advanceDamage"` // damage of an attack right after an ADVANCE
+
+	// Energy gained or spent by each action
+	WaitGain       int `json:"waitGain"`
+	RetreatCost    int `json:"retreatCost"`
+	AdvanceCost    int `json:"advanceCost"`
+	MissCost       int `json:"missCost"`       // attack that lands on nothing
+	CounterPenalty int `json:"counterPenalty"` // counter with nothing to counter
+}
+
+// DefaultRuleset returns the standard rules.
+func DefaultRuleset() Ruleset {
+	return Ruleset{
+		Name:           DefaultRulesetName,
+		BoardWidth:     BoardWidth,
+		StartPos:       [2]int{2, 4},
+		StartEnergy:    StartEnergy,
+		MaxTurns:       MaxTurns,
+		NormalDamage:   NormalDamage,
+		AdvanceDamage:  AdvanceDamage,
+		WaitGain:       1,
+		RetreatCost:    1,
+		AdvanceCost:    1,
+		MissCost:       1,
+		CounterPenalty: 2,
+	}
+}
+
+// Validate reports whether a duel can be played under r.
+func (r Ruleset) Validate() error {
+	if r.Name == "" {
+		return errors.New("ruleset has no name")
+	}
+	if r.BoardWidth < 3 {
+		return fmt.Errorf("ruleset %s: board width must be at least 3, got %d", r.Name, r.BoardWidth)
+	}
+	p1, p2 := r.StartPos[0], r.StartPos[1]
+	if p1 < 0 || p2 >= r.BoardWidth || p1 >= p2 {
+		return fmt.Errorf("ruleset %s: start positions %d and %d must be on the board with player 1 on the left", r.Name, p1, p2)
+	}
+	if r.StartEnergy < 1 || r.MaxTurns < 1 {
+		return fmt.Errorf("ruleset %s: start energy and max turns must be positive", r.Name)
+	}
+	for _, v := range []int{r.NormalDamage, r.AdvanceDamage, r.WaitGain, r.RetreatCost, r.AdvanceCost, r.MissCost, r.CounterPenalty} {
+		if v < 0 {
+			return fmt.Errorf("ruleset %s: damage and energy values must not be negative", r.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+// Package rating implements the Elo rating system used for rated matches.
+package rating
+
+import "math"
+
+const (
+	// Initial is the rating of a player who has not finished a rated match.
+	Initial = 1500
+	// K is the most a rating can move in one match.
+	K = 32
+)
+
+// Scores of a match from one player's point of view.
+const (
+	Loss = 0.0
+	Draw = 0.5
+	Win  = 1.0
+)
+
+// Expected returns the score a player rated a is expected to get against a
+// player rated b.
+func Expected(a, b int) float64 {
+	return 1 / (1 + math.Pow(10, float64(b-a)/400))
+}
+
+// Update returns the new ratings of two players rated a and b after a match
+// in which the first scored score.
+func Update(a, b int, score float64) (int, int) {
+	delta := int(math.Round(K * (score - Expected(a, b))))
+	return a + delta, b - delta
+}
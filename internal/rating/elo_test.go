@@ -0,0 +1,23 @@
+package rating
+
+import "testing"
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		a, b       int
+		score      float64
+		newA, newB int
+	}{
+		{Initial, Initial, Win, 1516, 1484},
+		{Initial, Initial, Draw, Initial, Initial},
+		{Initial, Initial, Loss, 1484, 1516},
+		{1700, 1500, Win, 1708, 1492}, // the favourite gains little
+		{1500, 1700, Win, 1524, 1676}, // the upset gains a lot
+	}
+	for _, tt := range tests {
+		newA, newB := Update(tt.a, tt.b, tt.score)
+		if newA != tt.newA || newB != tt.newB {
+			t.Errorf("Update(%d, %d, %v) = %d, %d, expected %d, %d", tt.a, tt.b, tt.score, newA, newB, tt.newA, tt.newB)
+		}
+	}
+}
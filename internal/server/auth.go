@@ -0,0 +1,133 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"prisoner-fencing/internal/database"
+)
+
+// sessionMaxAge is how long a session token stays valid.
+const sessionMaxAge = 30 * 24 * time.Hour
+
+// sessionRefreshAge is how long a registered player can swap an expired token
+// for a fresh one, see refreshSessionHandler.
+const sessionRefreshAge = 365 * 24 * time.Hour
+
+var (
+	errInvalidToken   = errors.New("invalid session token")
+	errSessionExpired = errors.New("session token expired")
+)
+
+// sessions issues and verifies the signed tokens that tie a connection to a
+// player id. A token is "<player id>.<issued at>.<signature>" where the
+// signature is an HMAC-SHA256 of the rest under the server's secret.
+type sessions struct {
+	secret []byte
+}
+
+// newSessions returns a token issuer for secret. An empty secret picks a
+// random one, so tokens only last until the server restarts.
+func newSessions(secret string) *sessions {
+	if secret == "" {
+		key := make([]byte, 32)
+		rand.Read(key)
+		return &sessions{secret: key}
+	}
+	return &sessions{secret: []byte(secret)}
+}
+
+// issue returns a token for player id.
+func (s *sessions) issue(id string, now time.Time) string {
+	payload := id + "." + strconv.FormatInt(now.Unix(), 10)
+	return payload + "." + s.sign(payload)
+}
+
+// verify returns the player id a token was issued to.
+func (s *sessions) verify(token string, now time.Time) (string, error) {
+	id, issued, err := s.parse(token)
+	if err != nil {
+		return "", err
+	}
+	if now.Sub(issued) > sessionMaxAge {
+		return "", errSessionExpired
+	}
+	return id, nil
+}
+
+// parse checks the signature of a token, and returns the player id it was
+// issued to and when, however long ago that was.
+func (s *sessions) parse(token string) (string, time.Time, error) {
+	i := strings.LastIndex(token, ".")
+	if i < 0 {
+		return "", time.Time{}, errInvalidToken
+	}
+	payload, signature := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(s.sign(payload))) {
+		return "", time.Time{}, errInvalidToken
+	}
+	id, issued, ok := strings.Cut(payload, ".")
+	seconds, err := strconv.ParseInt(issued, 10, 64)
+	if !ok || err != nil || id == "" {
+		return "", time.Time{}, errInvalidToken
+	}
+	return id, time.Unix(seconds, 0), nil
+}
+
+func (s *sessions) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SessionResponse is a fresh session token for a player.
+type SessionResponse struct {
+	PlayerId string `json:"playerId"`
+	Token    string `json:"token"`
+}
+
+// refreshSessionHandler swaps the bearer token for a fresh one. An expired
+// token is only swapped for a registered player, for up to
+// sessionRefreshAge; a guest has nothing to come back to.
+func (s *Server) refreshSessionHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	id, issued, err := s.sessions.parse(token)
+	if !ok || err != nil {
+		http.Error(w, "Invalid session", http.StatusUnauthorized)
+		return
+	}
+	if age := now.Sub(issued); age > sessionMaxAge {
+		if age > sessionRefreshAge {
+			http.Error(w, "Session is too old to refresh", http.StatusUnauthorized)
+			return
+		}
+		_, err := s.db.GetPlayer(r.Context(), id)
+		if errors.Is(err, database.ErrNotFound) {
+			http.Error(w, "Only registered players can refresh an expired session", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to get player: %v", err)
+			http.Error(w, "Failed to get player", http.StatusInternalServerError)
+			return
+		}
+	}
+	writeJSON(w, SessionResponse{PlayerId: id, Token: s.sessions.issue(id, now)})
+}
+
+// newGuestId returns a fresh id for a player without a session.
+func newGuestId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "guest-" + hex.EncodeToString(b)
+}
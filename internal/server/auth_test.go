@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"prisoner-fencing/internal/database"
+)
+
+func TestSessions(t *testing.T) {
+	s := newSessions("secret")
+	now := time.Now()
+	token := s.issue("p1", now)
+
+	if id, err := s.verify(token, now); err != nil || id != "p1" {
+		t.Errorf("Expected the token to verify as p1, got %q (%v)", id, err)
+	}
+	if _, err := s.verify(strings.Replace(token, "p1", "p2", 1), now); err == nil {
+		t.Errorf("Expected a token with a changed id to be rejected")
+	}
+	if _, err := newSessions("other").verify(token, now); err == nil {
+		t.Errorf("Expected a token signed with another secret to be rejected")
+	}
+	if _, err := s.verify(token, now.Add(sessionMaxAge+time.Minute)); !errors.Is(err, errSessionExpired) {
+		t.Errorf("Expected an expired token to be rejected as expired, got %v", err)
+	}
+}
+
+func TestInitClient(t *testing.T) {
+	h := NewHub()
+
+	// A new guest gets an id and a token for it
+	c1, r1 := newTestClient(h, "")
+	if err := send(t, c1, EventListRooms, nil); err == nil {
+		t.Errorf("Expected events before init_client to be rejected")
+	}
+	if err := send(t, c1, EventInitClient, InitClientEvent{}); err != nil {
+		t.Fatalf("failed to init guest: %v", err)
+	}
+	var guest InitClientResponse
+	if err := json.Unmarshal(waitFor(t, r1, EventInitClient).Payload, &guest); err != nil {
+		t.Fatalf("failed to unmarshal init client response: %v", err)
+	}
+	if !strings.HasPrefix(guest.PlayerId, "guest-") || c1.id != guest.PlayerId {
+		t.Errorf("Expected a guest id, got %q", guest.PlayerId)
+	}
+	if err := send(t, c1, EventInitClient, InitClientEvent{}); err == nil {
+		t.Errorf("Expected a second init_client to be rejected")
+	}
+
+	// The token brings the same player back on a new connection
+	c2, r2 := newTestClient(h, "")
+	send(t, c2, EventInitClient, InitClientEvent{Token: guest.Token})
+	var again InitClientResponse
+	json.Unmarshal(waitFor(t, r2, EventInitClient).Payload, &again)
+	if again.PlayerId != guest.PlayerId {
+		t.Errorf("Expected the token to restore %q, got %q", guest.PlayerId, again.PlayerId)
+	}
+
+	// A token that does not verify is an error, not a new guest
+	c3, r3 := newTestClient(h, "")
+	send(t, c3, EventInitClient, InitClientEvent{Token: guest.PlayerId + ".0.forged"})
+	expectError(t, r3, CodeInvalidSession, EventInitClient)
+	send(t, c3, EventInitClient, InitClientEvent{Token: h.sessions.issue(guest.PlayerId, time.Now().Add(-sessionMaxAge-time.Hour))})
+	expectError(t, r3, CodeSessionExpired, EventInitClient)
+	if c3.id != "" {
+		t.Errorf("Expected a rejected token to leave the client without an id, got %q", c3.id)
+	}
+
+	// Starting over without a token is still possible
+	send(t, c3, EventInitClient, InitClientEvent{})
+	var fresh InitClientResponse
+	json.Unmarshal(waitFor(t, r3, EventInitClient).Payload, &fresh)
+	if fresh.PlayerId == "" || fresh.PlayerId == guest.PlayerId {
+		t.Errorf("Expected a new guest id, got %q", fresh.PlayerId)
+	}
+}
+
+func TestRefreshSession(t *testing.T) {
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	s := &Server{db: db, sessions: newSessions("secret")}
+	server := httptest.NewServer(s.RegisterRoutes())
+	defer server.Close()
+
+	refresh := func(token string) (SessionResponse, int) {
+		t.Helper()
+		req, _ := http.NewRequest("POST", server.URL+"/sessions/refresh", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+		defer resp.Body.Close()
+		var session SessionResponse
+		if resp.StatusCode == http.StatusOK {
+			json.NewDecoder(resp.Body).Decode(&session)
+		}
+		return session, resp.StatusCode
+	}
+	now := time.Now()
+	expired := now.Add(-sessionMaxAge - time.Hour)
+	if err := db.CreatePlayer(context.Background(), database.Player{Id: "guest-1", DisplayName: "Zorro", Avatar: "fencer", CreatedAt: now}); err != nil {
+		t.Fatalf("failed to register player: %v", err)
+	}
+
+	tests := []struct {
+		name, token string
+		status      int
+	}{
+		{"valid", s.sessions.issue("guest-2", now), http.StatusOK},
+		{"expired registered", s.sessions.issue("guest-1", expired), http.StatusOK},
+		{"expired guest", s.sessions.issue("guest-2", expired), http.StatusUnauthorized},
+		{"too old", s.sessions.issue("guest-1", now.Add(-sessionRefreshAge-time.Hour)), http.StatusUnauthorized},
+		{"other secret", newSessions("other").issue("guest-1", now), http.StatusUnauthorized},
+		{"missing", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		session, status := refresh(tt.token)
+		if status != tt.status {
+			t.Errorf("%s: expected status %d; got %d", tt.name, tt.status, status)
+			continue
+		}
+		if status != http.StatusOK {
+			continue
+		}
+		if id, err := s.sessions.verify(session.Token, now); err != nil || id != session.PlayerId {
+			t.Errorf("%s: expected a fresh token for %s, got %+v (%v)", tt.name, session.PlayerId, session, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"prisoner-fencing/internal/bot"
+	"prisoner-fencing/internal/engine"
+)
+
+// botCount numbers bots so each gets its own player id.
+var botCount atomic.Int64
+
+// addBot seats a bot of the given strength in room. The bot is a client
+// without a connection: it reads the events the room sends it and answers
+// through the same handlers as a websocket client.
+func (h *Hub) addBot(room, strength string) {
+	b, err := bot.New(strength, 0)
+	if err != nil {
+		log.Printf("Failed to create bot: %v", err)
+		return
+	}
+	c := NewClient(nil, h)
+	c.id = fmt.Sprintf("bot-%s-%d", strength, botCount.Add(1))
+	c.bot = true
+	h.addClient(c)
+	h.setDisplayName(c.id, fmt.Sprintf("Bot (%s)", strength))
+	go playBot(c, b, room)
+
+	payload, _ := json.Marshal(JoinRoomEvent{Room: room})
+	if err := h.routeEvent(Event{Type: EventJoinRoom, Payload: payload}, c); err != nil {
+		log.Printf("Bot %s failed to join room %s: %v", c.id, room, err)
+		h.removeClient(c)
+	}
+}
+
+// playBot handles the events bot client c is sent in room until it is
+// removed. Its replies are routed from their own goroutines, since the room
+// waits for c to take each event before it handles the next command.
+func playBot(c *Client, b *bot.Bot, room string) {
+	lastTurn := -1
+	var action engine.Action // chosen action awaiting reveal in commit-reveal rooms
+	var nonce string
+
+	for {
+		var event Event
+		select {
+		case event = <-c.egress:
+		case <-c.done:
+			return
+		}
+
+		switch event.Type {
+		case "GAME_ACTION_RESULT":
+			var gs GameState
+			if err := json.Unmarshal(event.Payload, &gs); err != nil {
+				log.Printf("Bot %s failed to unmarshal game state: %v", c.id, err)
+				continue
+			}
+			if gs.GameOver && gs.Series != nil && !gs.Series.Over {
+				// Stay for the next game of the series
+				lastTurn = -1
+				go botRoute(c, EventRematch, map[string]string{"room": room})
+				continue
+			}
+			if gs.GameOver {
+				go func() {
+					botRoute(c, EventLeaveRoom, nil)
+					c.hub.removeClient(c)
+				}()
+				continue
+			}
+			you, seated := gs.PlayerStates["you"]
+			opponent, full := gs.PlayerStates["opponent"]
+			if !seated || !full || gs.Turn == lastTurn {
+				continue
+			}
+			lastTurn = gs.Turn
+
+			side := you.Player - 1
+			s := engine.State{Turn: gs.Turn, MaxTurns: gs.MaxTurns, Rules: gs.Ruleset}
+			s.Players[side] = engine.Player{Pos: you.Pos, Energy: you.Energy, Advanced: you.Advanced}
+			s.Players[1-side] = engine.Player{Pos: opponent.Pos, Energy: opponent.Energy, Advanced: opponent.Advanced}
+			action = b.Choose(s, side)
+
+			if gs.CommitReveal {
+				nonce = botNonce()
+				go botRoute(c, EventGameCommit, map[string]string{"room": room, "commitment": engine.Commitment(action, nonce)})
+			} else {
+				go botRoute(c, EventGameAction, map[string]string{"room": room, "action": string(action)})
+			}
+		case "REVEAL_ACTIONS":
+			go botRoute(c, EventGameReveal, map[string]string{"room": room, "action": string(action), "nonce": nonce})
+		}
+	}
+}
+
+// botRoute routes an event from bot client c as if it came over a websocket.
+func botRoute(c *Client, eventType string, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to marshal bot event: %v", err)
+		return
+	}
+	if err := c.hub.routeEvent(Event{Type: eventType, Payload: data}, c); err != nil {
+		log.Printf("Bot %s failed to route %s: %v", c.id, eventType, err)
+	}
+}
+
+// botNonce returns a random nonce for a bot's commitment.
+func botNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
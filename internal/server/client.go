@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"sync"
 
 	"github.com/coder/websocket"
 )
@@ -13,16 +14,28 @@ type ClientList map[*Client]bool
 type Client struct {
 	connection *websocket.Conn
 	hub        *Hub
-	room       string // The room the client is currently in
+	room       string // The room the client is currently in, guarded by the hub lock, see clientRoom
 	id         string // Unique player identifier
 	// egress is used to avoid concurrent writes to the websocket connection.
 	egress chan Event
+	// done is closed once the client has disconnected.
+	done      chan struct{}
+	closeOnce sync.Once
+	// bot is set for the server's own players, see addBot.
+	bot bool
 }
 
 func (c *Client) writeMessages() {
 	defer c.hub.removeClient(c)
 
-	for message := range c.egress {
+	for {
+		var message Event
+		select {
+		case message = <-c.egress:
+		case <-c.done:
+			return
+		}
+
 		data, err := json.Marshal(message)
 		if err != nil {
 			log.Printf("Failed to marshal message: %v", err)
@@ -44,9 +57,15 @@ func NewClient(conn *websocket.Conn, hub *Hub) *Client {
 		connection: conn,
 		hub:        hub,
 		egress:     make(chan Event),
+		done:       make(chan struct{}),
 	}
 }
 
+// close marks the client as disconnected. It is safe to call more than once.
+func (c *Client) close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
 // generateRandomID returns a random string to be used as a client ID.
 // func generateRandomID(length int) string {
 // 	charset := "abcdefghijklmnopqrstuvwxyz"
@@ -74,6 +93,7 @@ func (c *Client) readMessages() {
 		var event Event
 		if err := json.Unmarshal(payload, &event); err != nil {
 			log.Printf("Failed to unmarshal event: %v", err)
+			emitError(Event{}, handlerError(CodeBadRequest, "failed to unmarshal event: %v", err), c)
 			continue
 		}
 
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Error codes sent to a client in an error event, so it can tell why a request
+// was rejected without parsing the message.
+const (
+	CodeBadRequest         = "bad_request"         // the payload could not be parsed
+	CodeUnknownEvent       = "unknown_event"       // no handler for the event type
+	CodeNotInitialized     = "not_initialized"     // the client must send init_client first
+	CodeAlreadyInitialized = "already_initialized" // init_client was sent twice
+	CodeInvalidSession     = "invalid_session"     // the session token was not issued by this server
+	CodeSessionExpired     = "session_expired"     // a registered player can refresh it with POST /sessions/refresh
+	CodeInvalidSettings    = "invalid_settings"    // the room settings were rejected
+	CodeRoomNotFound       = "room_not_found"
+	CodeNotInRoom          = "not_in_room"
+	CodeNoSeat             = "no_seat"     // there is no seat for the client to take
+	CodeNotSeated          = "not_seated"  // only seated players may do that
+	CodeWrongPhase         = "wrong_phase" // the room is not expecting that event now
+	CodeInvalidAction      = "invalid_action"
+	CodeInvalidPayload     = "invalid_payload" // a field of the payload is malformed
+	CodeAlreadySubmitted   = "already_submitted"
+	CodeGameOver           = "game_over"
+	CodeAlreadyQueued      = "already_queued"
+	CodeNotQueued          = "not_queued"
+	CodeNotInvited         = "not_invited" // the room needs a password or invite code the client did not give
+	CodeTournamentNotFound = "tournament_not_found"
+	CodeCommitmentMismatch = "commitment_mismatch"
+	CodeInternal           = "internal"
+)
+
+// HandlerError is an error an event handler returns to reject a request. Its
+// code and message are sent back to the client.
+type HandlerError struct {
+	Code    string
+	Message string
+}
+
+func (e *HandlerError) Error() string {
+	return e.Message
+}
+
+// handlerError returns a HandlerError with a formatted message.
+func handlerError(code, format string, args ...any) error {
+	return &HandlerError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// ErrorEvent is the payload of an error event.
+type ErrorEvent struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Event   string `json:"event"` // type of the event that failed
+}
+
+// emitError tells c that event failed. Errors that are not HandlerErrors are
+// internal, and their details stay in the log.
+func emitError(event Event, err error, c *Client) {
+	payload := ErrorEvent{Code: CodeInternal, Message: "internal server error", Event: event.Type}
+	var he *HandlerError
+	if errors.As(err, &he) {
+		payload.Code, payload.Message = he.Code, he.Message
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to marshal error event: %v", err)
+		return
+	}
+	emit(Event{Type: EventError, Payload: data, ID: event.ID}, c)
+}
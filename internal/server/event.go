@@ -8,6 +8,9 @@ import (
 type Event struct {
 	Type    string          `json:"type"`
 	Payload json.RawMessage `json:"payload"`
+	// ID is an optional id a client gives an event. The server echoes it
+	// on its direct replies to that event: the response, error or ack.
+	ID string `json:"id,omitempty"`
 }
 type EventHandler func(event Event, c *Client) error
 
@@ -19,6 +22,26 @@ const (
 	EventLeaveRoom   = "leave_room"
 	EventInitClient  = "init_client"
 	EventGameAction  = "game_action"
+	EventGameCommit  = "game_commit"
+	EventGameReveal  = "game_reveal"
+	EventRematch     = "rematch"
+	EventError       = "error"
+	EventAck         = "ack"
+	EventQueueJoin   = "queue_join"
+	EventQueueLeave  = "queue_leave"
+	EventMatchFound  = "match_found"
+	// EventMatchCancelled tells a matched player their opponent never
+	// joined. They should leave the room.
+	EventMatchCancelled = "match_cancelled"
+	// EventRoomClosed tells the clients in a room that sat idle that it has
+	// closed, and they are back in the lobby.
+	EventRoomClosed = "room_closed"
+	// EventTournamentWatch asks for the updates of a tournament, which are
+	// sent as EventTournamentUpdate. EventTournamentMatch tells a player
+	// their next tournament match is ready.
+	EventTournamentWatch  = "tournament_watch"
+	EventTournamentUpdate = "tournament_update"
+	EventTournamentMatch  = "tournament_match"
 )
 
 type SendMessageEvent struct {
@@ -28,11 +51,19 @@ type SendMessageEvent struct {
 
 type NewMessageEvent struct {
 	SendMessageEvent
+	Name string    `json:"name"` // display name of From
 	Sent time.Time `json:"sent"`
 }
 
 type JoinRoomEvent struct {
 	Room string `json:"room"`
+	// Settings apply when the join creates the room, and are ignored otherwise.
+	Settings *RoomSettings `json:"settings,omitempty"`
+	// Spectate joins to watch even if a seat is free. The room must exist.
+	Spectate bool `json:"spectate,omitempty"`
+	// Password or Invite code needed to join a private or invite room.
+	Password string `json:"password,omitempty"`
+	Invite   string `json:"invite,omitempty"`
 }
 
 type ListRoomEvent struct {
@@ -40,9 +71,23 @@ type ListRoomEvent struct {
 }
 
 type ListRoomResponse struct {
-	Rooms []string `json:"rooms"`
+	Rooms []RoomInfo `json:"rooms"`
+}
+
+// AckEvent is the payload of an ack, sent once a game action, commit or reveal
+// has been accepted.
+type AckEvent struct {
+	Event string `json:"event"` // type of the accepted event
 }
 
 type InitClientEvent struct {
+	// Token is the session token from an earlier init_client response.
+	// Without a valid one the client becomes a new guest.
+	Token string `json:"token,omitempty"`
+}
+
+type InitClientResponse struct {
 	PlayerId string `json:"playerId"`
+	Name     string `json:"name"` // display name
+	Token    string `json:"token"`
 }
@@ -3,6 +3,11 @@ package server
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
+
+	"prisoner-fencing/internal/database"
+	"prisoner-fencing/internal/engine"
 )
 
 type GameState struct {
@@ -11,251 +16,310 @@ type GameState struct {
 	LastAction   string                 `json:"lastAction"`
 	GameOver     bool                   `json:"gameOver"`
 	Winner       string                 `json:"winner"`
+	Reason       string                 `json:"reason,omitempty"` // why the game ended, see Reason constants
 	Status       string                 `json:"status"`
-	PlayerStates map[string]PlayerState `json:"playerStates"` // id -> state
+	TimeLeft     int64                  `json:"timeLeft,omitempty"` // milliseconds left to choose an action, when the room has a turn timer
+	CommitReveal bool                   `json:"commitReveal,omitempty"`
+	Casual       bool                   `json:"casual,omitempty"`    // the result does not change ratings
+	TieBreak     string                 `json:"tieBreak"`            // policy for a square both players advance into
+	Ruleset      engine.Ruleset         `json:"ruleset"`             // rules the room plays by, including the board width
+	PlayerStates map[string]PlayerState `json:"playerStates"`        // "you" and "opponent", or "player1" and "player2" for a spectator
+	Spectator    bool                   `json:"spectator,omitempty"` // this is a spectator's view
+	Spectators   int                    `json:"spectators"`          // number of clients watching
+	Series       *SeriesScore           `json:"series,omitempty"`    // in rooms playing best-of series
+
+	startedAt time.Time       // when the second player sat down
+	history   []database.Turn // every resolved turn, for the match record
 }
 
+// Reasons a game can end.
+const (
+	ReasonElimination = "elimination"
+	ReasonEnergy      = "energy"
+	ReasonForfeit     = "forfeit"
+	ReasonDisconnect  = "disconnect"
+)
+
 type PlayerState struct {
-	Pos      int    `json:"pos"`
-	Energy   int    `json:"energy"`
-	Action   string `json:"action"`
-	Advanced bool   `json:"advanced"`
-	Player   int    `json:"player"` // 1 for you, 2 for opponent
-}
+	Pos      int           `json:"pos"`
+	Energy   int           `json:"energy"`
+	Action   engine.Action `json:"action"`
+	Advanced bool          `json:"advanced"`
+	Player   int           `json:"player"`         // 1 for you, 2 for opponent
+	Name     string        `json:"name,omitempty"` // display name, attached by the server
+	// Commit-reveal rooms only. Both are shown with the turn result so
+	// players can check the commitment themselves.
+	Commitment string `json:"commitment,omitempty"`
+	Nonce      string `json:"nonce,omitempty"`
 
-var RoomStates = make(map[string]*GameState)
+	submittedAt time.Time // when the action, or its commitment, came in
+}
 
 func GameActionHandler(event Event, c *Client) error {
-
 	var payload struct {
-		Room     string `json:"room"`
-		PlayerId string `json:"playerId"`
-		Action   string `json:"action"`
+		Room   string `json:"room"`
+		Action string `json:"action"`
 	}
 	if err := json.Unmarshal(event.Payload, &payload); err != nil {
-		return fmt.Errorf("failed to unmarshal game action: %v", err)
+		return handlerError(CodeBadRequest, "failed to unmarshal game action: %v", err)
+	}
+	action, err := engine.ParseAction(payload.Action)
+	if err != nil {
+		return handlerError(CodeInvalidAction, "%v", err)
 	}
 
-	gs, ok := RoomStates[payload.Room]
-	if !ok {
-		return fmt.Errorf("game state not initialized for room: %s", payload.Room)
+	room, err := gameRoom(c, payload.Room)
+	if err != nil {
+		return err
+	}
+	if err := room.send(roomCommand{kind: commandAction, client: c, id: c.id, action: action}); err != nil {
+		return err
 	}
+	return ack(event, c)
+}
 
-	// Set or update player action only
-	if ps, exists := gs.PlayerStates[c.id]; exists {
-		ps.Action = payload.Action
-		gs.PlayerStates[c.id] = ps
-	} else {
-		return fmt.Errorf("player not initialized in room: %s", payload.Room)
+func GameCommitHandler(event Event, c *Client) error {
+	var payload struct {
+		Room       string `json:"room"`
+		Commitment string `json:"commitment"`
+	}
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return handlerError(CodeBadRequest, "failed to unmarshal game commit: %v", err)
 	}
 
-	// Get both player ids
-	var ids []string
-	for pid := range gs.PlayerStates {
-		ids = append(ids, pid)
+	room, err := gameRoom(c, payload.Room)
+	if err != nil {
+		return err
+	}
+	if err := room.send(roomCommand{kind: commandCommit, client: c, id: c.id, secret: payload.Commitment}); err != nil {
+		return err
+	}
+	return ack(event, c)
+}
+
+func GameRevealHandler(event Event, c *Client) error {
+	var payload struct {
+		Room   string `json:"room"`
+		Action string `json:"action"`
+		Nonce  string `json:"nonce"`
+	}
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return handlerError(CodeBadRequest, "failed to unmarshal game reveal: %v", err)
+	}
+	action, err := engine.ParseAction(payload.Action)
+	if err != nil {
+		return handlerError(CodeInvalidAction, "%v", err)
 	}
 
-	if len(ids) != 2 {
-		emit(Event{
-			Type:    "UPDATE_STATUS",
-			Payload: json.RawMessage(`{"status": "Waiting for opponent to arrive"}`),
-		}, c)
-		return nil
-	}
-	// Game logic
-	p1 := gs.PlayerStates[ids[0]]
-	p2 := gs.PlayerStates[ids[1]]
+	room, err := gameRoom(c, payload.Room)
+	if err != nil {
+		return err
+	}
+	if err := room.send(roomCommand{kind: commandReveal, client: c, id: c.id, action: action, secret: payload.Nonce}); err != nil {
+		return err
+	}
+	return ack(event, c)
+}
 
-	// Check if both players have made their actions
-	if p1.Action == "" || p2.Action == "" {
-		emit(Event{
-			Type:    "UPDATE_STATUS",
-			Payload: json.RawMessage(`{"status": "Waiting for opponent to act"}`),
-		}, c)
-		return nil
+// gameRoom returns the room called name for a game event from c, which must
+// be in it.
+func gameRoom(c *Client, name string) (*Room, error) {
+	room, ok := c.hub.findRoom(name)
+	if !ok {
+		return nil, handlerError(CodeRoomNotFound, "room not found: %s", name)
+	}
+	if c.hub.clientRoom(c) != name {
+		return nil, handlerError(CodeNotInRoom, "client is not in room: %s", name)
 	}
+	return room, nil
+}
 
-	// Simultaneous movement resolution
-	var intendedPos1, intendedPos2 int
-	var movementLog1, movementLog2 string
-	intendedPos1, p1.Energy, movementLog1 = p1.resolveIntendedMovement()
-	intendedPos2, p2.Energy, movementLog2 = p2.resolveIntendedMovement()
-	p1.Pos, p2.Pos = resolveSimultaneousMovement(p1.Pos, intendedPos1, p2.Pos, intendedPos2)
+// ack tells c that its event was accepted.
+func ack(event Event, c *Client) error {
+	data, err := json.Marshal(AckEvent{Event: event.Type})
+	if err != nil {
+		return fmt.Errorf("failed to marshal ack: %v", err)
+	}
+	emit(Event{Type: EventAck, Payload: data, ID: event.ID}, c)
+	return nil
+}
 
-	// Then resolve combat for both players
-	var combatLog1, combatLog2 string
-	p1.Energy, combatLog1 = p1.resolveCombat(&p2)
-	p2.Energy, combatLog2 = p2.resolveCombat(&p1)
+// newGameState returns the state of a room nobody has joined yet, to be
+// played under rules.
+func newGameState(rules engine.Ruleset) *GameState {
+	return &GameState{
+		Turn:         0,
+		MaxTurns:     rules.MaxTurns,
+		Ruleset:      rules,
+		GameOver:     false,
+		Status:       "Waiting for opponent to arrive",
+		PlayerStates: make(map[string]PlayerState),
+	}
+}
 
-	// Update game state for next round
-	gs.PlayerStates[ids[0]] = p1
-	gs.PlayerStates[ids[1]] = p2
-	gs.Turn++
-	gs.LastAction = fmt.Sprintf("P1: %s %s| P2: %s %s.", movementLog1, combatLog1, movementLog2, combatLog2)
+// seat gives player id, shown as name, the next free seat.
+func (gs *GameState) seat(id, name string) {
+	start := engine.NewState(gs.Ruleset)
+	if len(gs.PlayerStates) == 0 {
+		gs.PlayerStates[id] = PlayerState{Pos: start.Players[0].Pos, Energy: start.Players[0].Energy, Player: 1, Name: name}
+	} else {
+		gs.Status = "Game in progress, choose an action!"
+		gs.PlayerStates[id] = PlayerState{Pos: start.Players[1].Pos, Energy: start.Players[1].Energy, Player: 2, Name: name}
+	}
+}
 
-	// Send personalized state and winner to each client
-	for client := range c.hub.client {
-		if client.room == payload.Room {
-			// Assign 'you' and 'opponent' based on client.id
-			var youState, opponentState PlayerState
-			if client.id == ids[0] || client.id == ids[1] {
-				for pid, state := range gs.PlayerStates {
-					if pid == client.id {
-						youState = state
-					} else {
-						opponentState = state
-					}
-				}
-			} else {
-				youState = gs.PlayerStates[ids[0]]
-				opponentState = gs.PlayerStates[ids[1]]
-			}
-			personalized := *gs
-			personalized.PlayerStates = map[string]PlayerState{
-				"you":      youState,
-				"opponent": opponentState,
-			}
-			// Set personalized winner message
-			if youState.Energy > 0 && opponentState.Energy <= 0 {
-				personalized.Winner = "You win!"
-			} else if youState.Energy <= 0 && opponentState.Energy > 0 {
-				personalized.Winner = "Opponent wins!"
-			} else if youState.Energy <= 0 && opponentState.Energy <= 0 {
-				personalized.Winner = "Draw!"
-			} else if gs.Turn > gs.MaxTurns {
-				if youState.Energy > opponentState.Energy {
-					personalized.Winner = "You win by energy!"
-				} else if youState.Energy < opponentState.Energy {
-					personalized.Winner = "Opponent wins by energy!"
-				} else {
-					personalized.Winner = "Draw!"
-				}
-			}
-			personalized.Status = "Choose an action!"
+// resolveTurn plays the chosen actions of both seated players through the
+// engine, with priority deciding a contested square, and returns the result
+// and what happened.
+func (gs *GameState) resolveTurn(ids [2]string, priority engine.Priority) (engine.Result, []engine.Outcome) {
+	s := gs.engineState(ids)
+	s.Priority = priority
+	state, outcomes := engine.Resolve(s, gs.PlayerStates[ids[0]].Action, gs.PlayerStates[ids[1]].Action)
+	gs.applyEngineState(ids, state)
+	gs.LastAction = describeOutcomes(outcomes)
+	result := state.Result()
+	gs.GameOver = result.Over
+	return result, outcomes
+}
 
-			// If there is a winner, set personalized.GameOver to true
-			if personalized.Winner != "" {
-				personalized.GameOver = true
-				personalized.Status = "Game over!"
-			}
+// clearActions resets the chosen actions for the next turn.
+func (gs *GameState) clearActions(ids [2]string) {
+	for _, id := range ids {
+		ps := gs.PlayerStates[id]
+		ps.Action, ps.Commitment, ps.Nonce = "", "", ""
+		ps.submittedAt = time.Time{}
+		gs.PlayerStates[id] = ps
+	}
+}
 
-			data, _ := json.Marshal(personalized)
-			outgoing := Event{
-				Type:    "GAME_ACTION_RESULT",
-				Payload: data,
-			}
-			emit(outgoing, client)
+// seats returns the ids of player 1 and player 2, and false if the room does
+// not have two players yet.
+func (gs *GameState) seats() ([2]string, bool) {
+	var ids [2]string
+	for pid, ps := range gs.PlayerStates {
+		if ps.Player == 1 || ps.Player == 2 {
+			ids[ps.Player-1] = pid
 		}
 	}
+	return ids, ids[0] != "" && ids[1] != ""
+}
 
-	p1.Action = ""
-	p2.Action = ""
-	gs.PlayerStates[ids[0]] = p1
-	gs.PlayerStates[ids[1]] = p2
-	if gs.GameOver {
-		// Remove GameState
-		delete(RoomStates, c.room)
+// engineState converts the seated players into an engine.State.
+func (gs *GameState) engineState(ids [2]string) engine.State {
+	s := engine.State{Turn: gs.Turn, MaxTurns: gs.MaxTurns, Rules: gs.Ruleset}
+	for i, id := range ids {
+		ps := gs.PlayerStates[id]
+		s.Players[i] = engine.Player{Pos: ps.Pos, Energy: ps.Energy, Advanced: ps.Advanced}
 	}
-	return nil
+	return s
 }
 
-// Movement actions: WAIT, RETREAT, ADVANCE
-// Returns intended new position, new energy, and movement log
-func (p1 *PlayerState) resolveIntendedMovement() (int, int, string) {
-	switch p1.Action {
-	case "WAIT":
-		return p1.Pos, p1.Energy + 1, "WAIT: +1 Energy"
-	case "RETREAT":
-		var newPos int
-		if p1.Player == 1 {
-			newPos = max(0, p1.Pos-1)
-		} else {
-			newPos = min(6, p1.Pos+1)
-		}
-		return newPos, p1.Energy - 1, "RETREAT: -1 Energy"
-	case "ADVANCE":
-		var newPos int
-		if p1.Player == 1 {
-			newPos = min(6, p1.Pos+1)
-		} else {
-			newPos = max(0, p1.Pos-1)
-		}
-		p1.Advanced = true
-		return newPos, p1.Energy - 1, "ADVANCE: Double attack next turn"
+// applyEngineState copies an engine.State back onto the seated players.
+func (gs *GameState) applyEngineState(ids [2]string, s engine.State) {
+	gs.Turn = s.Turn
+	gs.MaxTurns = s.MaxTurns
+	for i, id := range ids {
+		ps := gs.PlayerStates[id]
+		ps.Pos = s.Players[i].Pos
+		ps.Energy = s.Players[i].Energy
+		ps.Advanced = s.Players[i].Advanced
+		gs.PlayerStates[id] = ps
 	}
-	return p1.Pos, p1.Energy, ""
 }
 
-// Combat actions: ATTACK, COUNTER
-func (p1 *PlayerState) resolveCombat(p2 *PlayerState) (int, string) {
-	log := ""
-	adjacent := abs(p1.Pos-p2.Pos) == 1
+// personalize returns a copy of the game state with PlayerStates keyed by
+// "you" and "opponent" from the point of view of the given seated player.
+func (gs *GameState) personalize(clientId string, ids [2]string) GameState {
+	you, opponent := ids[0], ids[1]
+	if clientId == ids[1] {
+		you, opponent = ids[1], ids[0]
+	}
+	personalized := *gs
+	personalized.PlayerStates = make(map[string]PlayerState)
+	if ps, ok := gs.PlayerStates[you]; ok {
+		personalized.PlayerStates["you"] = ps
+	}
+	if ps, ok := gs.PlayerStates[opponent]; ok {
+		personalized.PlayerStates["opponent"] = ps
+	}
+	return personalized
+}
 
-	switch p1.Action {
-	case "ATTACK":
-		dmg := 3
-		if p1.Advanced {
-			dmg = 6
-		}
-		switch p2.Action {
-		case "COUNTER":
-			if adjacent {
-				p1.Energy -= dmg
-				log = fmt.Sprintf("Opponent countered! takes %d damage.", dmg)
-			} else {
-				log = "Countered, but not adjacent. No damage."
-				p1.Energy--
-			}
-		case "RETREAT":
-			log = "Attack missed! Opponent retreated."
-			p1.Energy--
-		default:
-			if adjacent {
-				p2.Energy -= dmg
-				log = fmt.Sprintf("Attacked for %d damage.", dmg)
-			} else {
-				log = "Attack missed! Not adjacent."
-				p1.Energy--
-			}
-		}
-	case "COUNTER":
-		if p2.Action != "ATTACK" || !adjacent {
-			p1.Energy -= 2
-			log = "Countered nothing. -2 Energy."
+// spectate returns a copy of the game state with PlayerStates keyed by
+// "player1" and "player2", as seen by a spectator.
+func (gs *GameState) spectate(ids [2]string) GameState {
+	view := *gs
+	view.Spectator = true
+	view.PlayerStates = make(map[string]PlayerState)
+	for i, id := range ids {
+		if ps, ok := gs.PlayerStates[id]; ok {
+			view.PlayerStates[fmt.Sprintf("player%d", i+1)] = ps
 		}
 	}
-	if p1.Action != "ADVANCE" {
-		p1.Advanced = false
+	return view
+}
+
+// resultReason returns why a game decided by the rules ended.
+func resultReason(r engine.Result) string {
+	if r.ByEnergy {
+		return ReasonEnergy
+	}
+	return ReasonElimination
+}
+
+// winnerMessage describes the result from the point of view of player you.
+func winnerMessage(r engine.Result, reason string, you int) string {
+	switch {
+	case !r.Over:
+		return ""
+	case r.Winner == 0:
+		return "Draw!"
+	case r.Winner == you && reason == ReasonDisconnect:
+		return "Opponent disconnected. You win!"
+	case r.Winner == you && reason == ReasonForfeit:
+		return "Opponent left. You win!"
+	case r.Winner == you && reason == ReasonEnergy:
+		return "You win by energy!"
+	case r.Winner == you:
+		return "You win!"
+	case reason == ReasonDisconnect:
+		return "Opponent wins, player disconnected!"
+	case reason == ReasonForfeit:
+		return "Opponent wins by forfeit!"
+	case reason == ReasonEnergy:
+		return "Opponent wins by energy!"
+	default:
+		return "Opponent wins!"
 	}
-	return p1.Energy, log
 }
 
-// resolveSimultaneousMovement applies blocking, swap, and priority rules and returns new positions for both players
-func resolveSimultaneousMovement(pos1, intended1, pos2, intended2 int) (newPos1, newPos2 int) {
-	// Swap places: both blocked
-	if intended1 == pos2 && intended2 == pos1 {
-		return pos1, pos2
-	}
-	// Both try to move to same square (not their current): player 1 gets priority
-	if intended1 == intended2 && intended1 != pos1 && intended2 != pos2 {
-		return intended1, pos2
-	}
-	// p1 blocked by p2
-	if intended1 == pos2 && intended2 == pos2 {
-		return pos1, intended2
-	}
-	// p2 blocked by p1
-	if intended2 == pos1 && intended1 == pos1 {
-		return intended1, pos2
-	}
-	// Otherwise, both move
-	return intended1, intended2
+// spectatorWinnerMessage describes the result to someone watching players
+// with the given names.
+func spectatorWinnerMessage(r engine.Result, reason string, names [2]string) string {
+	if !r.Over {
+		return ""
+	}
+	if r.Winner == 0 {
+		return "Draw!"
+	}
+	winner, loser := names[r.Winner-1], names[2-r.Winner]
+	switch reason {
+	case ReasonDisconnect:
+		return fmt.Sprintf("%s wins, %s disconnected!", winner, loser)
+	case ReasonForfeit:
+		return fmt.Sprintf("%s wins by forfeit!", winner)
+	case ReasonEnergy:
+		return fmt.Sprintf("%s wins by energy!", winner)
+	}
+	return fmt.Sprintf("%s wins!", winner)
 }
 
-// abs returns the absolute value of an integer
-func abs(x int) int {
-	if x < 0 {
-		return -x
+// describeOutcomes turns the outcomes of a turn into the human readable
+// LastAction log.
+func describeOutcomes(outcomes []engine.Outcome) string {
+	var logs [2][]string
+	for _, o := range outcomes {
+		logs[o.Player-1] = append(logs[o.Player-1], o.Message)
 	}
-	return x
+	return fmt.Sprintf("P1: %s | P2: %s", strings.Join(logs[0], " "), strings.Join(logs[1], " "))
 }
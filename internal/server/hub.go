@@ -2,175 +2,253 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/coder/websocket"
+
+	"prisoner-fencing/internal/database"
+	"prisoner-fencing/internal/engine"
 )
 
+// defaultReconnectGrace is how long a disconnected player keeps their seat.
+const defaultReconnectGrace = 30 * time.Second
+
 type Hub struct {
-	client ClientList
+	client   ClientList
+	rooms    map[string]*Room
+	awaiting map[string]string // player id -> room holding their seat until they reconnect
 	sync.RWMutex
 	handlers map[string]EventHandler
+
+	// reconnectGrace is how long a seated player who drops may take to
+	// reconnect before forfeiting. Zero forfeits straight away.
+	reconnectGrace time.Duration
+	// idleTimeout is how long a room nobody is playing in may go without
+	// anything happening before it is closed. Zero keeps rooms open.
+	idleTimeout time.Duration
+	// defaultSettings are used for rooms created without settings.
+	defaultSettings RoomSettings
+	// rulesets a room can be played under, by name. Only read after the hub
+	// starts serving.
+	rulesets map[string]engine.Ruleset
+	// db stores finished matches. Nil keeps them in memory only.
+	db database.Service
+	// sessions issues the tokens players identify themselves with.
+	sessions *sessions
+	// names caches the display names of connected players, see displayName.
+	names map[string]string
+	// matchmaker pairs the players queueing for a game.
+	matchmaker *matchmaker
+	// tournaments are the tournaments being organized and played.
+	tournaments *tournaments
 }
 
 func (h *Hub) setupEventHandlers() {
 
 	h.handlers[EventSendMessage] = SendMessage
 	h.handlers[EventJoinRoom] = JoinRoomHandler
-	h.handlers[EventLeaveRoom] = SendMessage
+	h.handlers[EventLeaveRoom] = LeaveRoomHandler
 	h.handlers[EventListRooms] = ListRoomHandler
 	h.handlers[EventInitClient] = InitClientHandler
 	h.handlers[EventGameAction] = GameActionHandler
+	h.handlers[EventGameCommit] = GameCommitHandler
+	h.handlers[EventGameReveal] = GameRevealHandler
+	h.handlers[EventRematch] = RematchHandler
+	h.handlers[EventQueueJoin] = QueueJoinHandler
+	h.handlers[EventQueueLeave] = QueueLeaveHandler
+	h.handlers[EventTournamentWatch] = TournamentWatchHandler
 }
 
 func InitClientHandler(event Event, c *Client) error {
 	var initEvent InitClientEvent
 	if err := json.Unmarshal(event.Payload, &initEvent); err != nil {
-		return fmt.Errorf("failed to unmarshal init client event: %v", err)
+		return handlerError(CodeBadRequest, "failed to unmarshal init client event: %v", err)
+	}
+	if c.id != "" {
+		return handlerError(CodeAlreadyInitialized, "client is already initialized")
 	}
-	c.id = initEvent.PlayerId
-
-	// Notify the client of their player ID
-	emit(Event{
-		Type:    EventInitClient,
-		Payload: json.RawMessage(fmt.Sprintf(`{"playerId": "%s"}`, c.id)),
-	}, c)
-
-	return nil
-}
 
-func ListRoomHandler(event Event, c *Client) error {
-	var rooms []string
-	for client := range c.hub.client {
-		if client.room != "" && !contains(rooms, client.room) {
-			rooms = append(rooms, client.room)
+	// A token that does not verify is an error rather than a new guest, so
+	// nobody loses who they are without being told. Without a token the
+	// client starts over as a new guest.
+	now := time.Now()
+	id := newGuestId()
+	if initEvent.Token != "" {
+		var err error
+		if id, err = c.hub.sessions.verify(initEvent.Token, now); err != nil {
+			log.Printf("Rejected session token: %v", err)
+			if errors.Is(err, errSessionExpired) {
+				return handlerError(CodeSessionExpired, "session token expired, refresh it or start over without one")
+			}
+			return handlerError(CodeInvalidSession, "invalid session token, start over without one")
 		}
 	}
-	fmt.Printf("Available rooms: %v\n", rooms)
-	response := ListRoomResponse{Rooms: rooms}
-	data, err := json.Marshal(response)
+	c.hub.setId(c, id)
+
+	// Notify the client of their player ID, and a fresh token to present
+	// next time
+	data, err := json.Marshal(InitClientResponse{PlayerId: id, Name: c.hub.displayName(id), Token: c.hub.sessions.issue(id, now)})
 	if err != nil {
-		return fmt.Errorf("failed to marshal list room response: %v", err)
+		return fmt.Errorf("failed to marshal init client response: %v", err)
 	}
+	emit(Event{Type: EventInitClient, Payload: data, ID: event.ID}, c)
 
-	outgoingEvent := Event{
-		Type:    EventListRooms,
-		Payload: data,
+	// Put a returning player back into the game they dropped out of
+	name, ok := c.hub.awaitingReconnect(c.id)
+	if !ok {
+		return nil
+	}
+	room, ok := c.hub.findRoom(name)
+	if !ok {
+		return nil
+	}
+	c.hub.setRoom(c, name)
+	if err := room.send(roomCommand{kind: commandReconnect, client: c, id: c.id}); err != nil {
+		c.hub.setRoom(c, "")
+		return err
 	}
-	roomEmit(outgoingEvent, "", c.hub)
-
 	return nil
 }
 
-// contains checks if a slice of strings contains a specific string.
-func contains(slice []string, item string) bool {
-	for _, s := range slice {
-		if s == item {
-			return true
-		}
+func ListRoomHandler(event Event, c *Client) error {
+	data, err := json.Marshal(ListRoomResponse{Rooms: c.hub.roomList()})
+	if err != nil {
+		return fmt.Errorf("failed to marshal list room response: %v", err)
 	}
-	return false
+	emit(Event{Type: EventListRooms, Payload: data, ID: event.ID}, c)
+	return nil
 }
 
 func JoinRoomHandler(event Event, c *Client) error {
 	var joinRoomEvent JoinRoomEvent
 	if err := json.Unmarshal(event.Payload, &joinRoomEvent); err != nil {
-		return fmt.Errorf("failed to unmarshal join room event: %v", err)
-	}
-	c.room = joinRoomEvent.Room
-
-	emit(Event{
-		Type:    EventJoinRoom,
-		Payload: json.RawMessage(fmt.Sprintf(`{"room": "%s"}`, joinRoomEvent.Room)),
-	}, c)
-
-	// Initialize GameState for the room if it doesn't exist
-	if _, exists := RoomStates[c.room]; !exists {
-		RoomStates[c.room] = &GameState{
-			Turn:         0,
-			MaxTurns:     20,
-			GameOver:     false,
-			Status:       "Waiting for opponent to arrive",
-			PlayerStates: make(map[string]PlayerState),
+		return handlerError(CodeBadRequest, "failed to unmarshal join room event: %v", err)
+	}
+
+	name := c.hub.displayName(c.id)
+	// Settings only apply to a join that creates the room
+	_, exists := c.hub.findRoom(joinRoomEvent.Room)
+	var settings RoomSettings
+	if !exists {
+		var err error
+		if settings, err = c.hub.newRoomSettings(c, joinRoomEvent, name); err != nil {
+			return err
 		}
 	}
-	gs := RoomStates[c.room]
+	// A player in a room is not looking for another game
+	c.hub.matchmaker.leave(c)
 
-	// If less than two players, add this client as PlayerState
-	if _, exists := gs.PlayerStates[c.id]; !exists && len(gs.PlayerStates) < 2 {
-		if len(gs.PlayerStates) == 0 {
-			gs.PlayerStates[c.id] = PlayerState{Pos: 2, Energy: 10, Action: "", Advanced: false, Player: 1}
+	// Leave the room the client was in before
+	if current := c.hub.clientRoom(c); current != "" && current != joinRoomEvent.Room {
+		if room, ok := c.hub.findRoom(current); ok {
+			room.send(roomCommand{kind: commandLeave, client: c})
+		}
+	}
+	c.hub.setRoom(c, joinRoomEvent.Room)
 
-		} else {
-			gs.Status = "Game in progress, choose an action!"
-			gs.PlayerStates[c.id] = PlayerState{Pos: 4, Energy: 10, Action: "", Advanced: false, Player: 2}
+	key := joinRoomEvent.Password
+	if key == "" {
+		key = joinRoomEvent.Invite
+	}
+	for {
+		room, ok := c.hub.findRoom(joinRoomEvent.Room)
+		if !ok {
+			// The room is gone since, so the join creates it after all
+			if exists {
+				var err error
+				if settings, err = c.hub.newRoomSettings(c, joinRoomEvent, name); err != nil {
+					c.hub.setRoom(c, "")
+					return err
+				}
+				exists = false
+			}
+			room = c.hub.room(joinRoomEvent.Room, settings)
 		}
-	} else {
-		// Room full or player already exists, send game state for spectator
-		// Prepare GameState for client, replacing PlayerStates keys with "you" and "opponent"
-		var ids []string
-		for pid := range gs.PlayerStates {
-			ids = append(ids, pid)
+		err := room.send(roomCommand{kind: commandJoin, client: c, id: c.id, name: name, secret: key, reply: event.ID, spectate: joinRoomEvent.Spectate})
+		// The room closed before it saw the join, so try again with a fresh one
+		if err == errRoomClosed {
+			continue
 		}
-		p1 := gs.PlayerStates[ids[0]]
-		p2 := gs.PlayerStates[ids[1]]
-		p1.Action = "" // Prevent peek next action
-		p2.Action = "" // Prevent peek next action
-		mappedPlayerStates := make(map[string]PlayerState)
-		mappedPlayerStates["you"] = p1
-		mappedPlayerStates["opponent"] = p2
-		gsCopy := *gs
-		gsCopy.PlayerStates = mappedPlayerStates
-
-		data, _ := json.Marshal(gsCopy)
-		emit(Event{
-			Type:    "GAME_ACTION_RESULT",
-			Payload: data,
-		}, c)
-		return nil
+		// The client was let in nowhere, so is back in the lobby
+		if err != nil {
+			c.hub.setRoom(c, "")
+		}
+		return err
 	}
+}
 
-	// get list of rooms
-	ListRoomHandler(Event{Type: EventListRooms}, c)
-
-	// Prepare GameState for client, replacing PlayerStates keys with "you" and "opponent"
-	mappedPlayerStates := make(map[string]PlayerState)
-	for pid, ps := range gs.PlayerStates {
-		if pid == c.id {
-			mappedPlayerStates["you"] = ps
-		} else {
-			mappedPlayerStates["opponent"] = ps
+// newRoomSettings returns the settings of the room a join creates: those of
+// its tournament match for a tournament room, or else the joiner's own. Only
+// the matchmaker creates match rooms, and nobody creates a room to watch it.
+func (h *Hub) newRoomSettings(c *Client, join JoinRoomEvent, name string) (RoomSettings, error) {
+	notFound := handlerError(CodeRoomNotFound, "room not found: %s", join.Room)
+	if strings.HasPrefix(join.Room, tournamentRoomPrefix) {
+		// Opened again for matches still to be played
+		settings, ok := h.tournaments.roomSettings(join.Room)
+		if !ok {
+			return RoomSettings{}, notFound
 		}
+		return settings, nil
+	}
+	if join.Spectate || strings.HasPrefix(join.Room, matchRoomPrefix) {
+		return RoomSettings{}, notFound
 	}
-	gsCopy := *gs
-	gsCopy.PlayerStates = mappedPlayerStates
 
-	data, err := json.Marshal(gsCopy)
-	if err != nil {
-		return fmt.Errorf("failed to marshal join room response: %v", err)
+	settings := h.defaultSettings
+	if join.Settings != nil {
+		settings = *join.Settings
 	}
-	roomEmit(Event{
-		Type:    "GAME_ACTION_RESULT",
-		Payload: data,
-	}, c.room, c.hub)
+	if err := settings.normalize(h); err != nil {
+		return RoomSettings{}, handlerError(CodeInvalidSettings, "%v", err)
+	}
+	settings.owner, settings.ownerName = c.id, name
+	return settings, nil
+}
 
-	return nil
+func LeaveRoomHandler(event Event, c *Client) error {
+	current := c.hub.clientRoom(c)
+	if current == "" {
+		return handlerError(CodeNotInRoom, "client is not in a room")
+	}
+	room, ok := c.hub.findRoom(current)
+	if ok {
+		err := room.send(roomCommand{kind: commandLeave, client: c, reply: event.ID})
+		if err != nil && err != errRoomClosed {
+			return err
+		}
+		ok = err == nil
+	}
+	// The room is gone, so answer for it
+	if !ok {
+		emit(Event{
+			Type:    EventLeaveRoom,
+			Payload: json.RawMessage(fmt.Sprintf(`{"room": "%s"}`, current)),
+			ID:      event.ID,
+		}, c)
+	}
+	c.hub.setRoom(c, "")
+
+	// The client is back in the lobby, and the room may be gone
+	return c.hub.emitRoomList()
 }
 
 func SendMessage(event Event, c *Client) error {
 	var chatEvent SendMessageEvent
 	if err := json.Unmarshal(event.Payload, &chatEvent); err != nil {
-		log.Printf("Failed to unmarshal send message event: %v", err)
-		return err
+		return handlerError(CodeBadRequest, "failed to unmarshal send message event: %v", err)
 	}
 
 	var broadMessage NewMessageEvent
 	broadMessage.Sent = time.Now()
-	broadMessage.From = chatEvent.From
+	// The sender is whoever the session says, not what the client claims
+	broadMessage.From = c.id
+	broadMessage.Name = c.hub.displayName(c.id)
 	broadMessage.Message = chatEvent.Message
 
 	data, err := json.Marshal(broadMessage)
@@ -182,28 +260,56 @@ func SendMessage(event Event, c *Client) error {
 		Type:    EventNewMessage,
 		Payload: data,
 	}
-	roomEmit(outgoingEvent, c.room, c.hub)
-
-	return nil
+	current := c.hub.clientRoom(c)
+	if current == "" {
+		c.hub.lobbyEmit(outgoingEvent)
+		return nil
+	}
+	room, ok := c.hub.findRoom(current)
+	if !ok {
+		return handlerError(CodeRoomNotFound, "room not found: %s", current)
+	}
+	return room.send(roomCommand{kind: commandChat, client: c, event: outgoingEvent})
 }
 
 func NewHub() *Hub {
 	h := &Hub{
 		client:   make(ClientList),
+		rooms:    make(map[string]*Room),
+		awaiting: make(map[string]string),
 		handlers: make(map[string]EventHandler),
+
+		reconnectGrace: defaultReconnectGrace,
+		idleTimeout:    defaultIdleTimeout,
+		rulesets:       map[string]engine.Ruleset{engine.DefaultRulesetName: engine.DefaultRuleset()},
+		sessions:       newSessions(""),
+		names:          make(map[string]string),
 	}
+	h.matchmaker = newMatchmaker(h)
+	h.tournaments = newTournaments(h)
 	h.setupEventHandlers()
 	return h
 }
 
+// routeEvent hands an event to its handler. If that fails the client is sent
+// an error event saying why, and the error is returned.
 func (h *Hub) routeEvent(event Event, c *Client) error {
+	err := h.handle(event, c)
+	if err != nil {
+		emitError(event, err, c)
+	}
+	return err
+}
+
+func (h *Hub) handle(event Event, c *Client) error {
+	// Everything but init_client needs to know who the client is
+	if event.Type != EventInitClient && c.id == "" {
+		return handlerError(CodeNotInitialized, "client is not initialized")
+	}
 	if handler, ok := h.handlers[event.Type]; ok {
-		if err := handler(event, c); err != nil {
-			return err
-		}
-		return nil
+		return handler(event, c)
 	}
-	return fmt.Errorf("no handler for event type: %s", event.Type)
+	return handlerError(CodeUnknownEvent, "no handler for event type: %s", event.Type)
 }
 
 func (h *Hub) serveWS(w http.ResponseWriter, r *http.Request) {
@@ -231,31 +337,142 @@ func (h *Hub) addClient(client *Client) {
 }
 
 func (h *Hub) removeClient(client *Client) {
+	// Unblock anything still sending to the client before taking the lock
+	client.close()
+	h.matchmaker.leave(client)
+	h.tournaments.unwatch(client)
+
 	h.Lock()
-	defer h.Unlock()
-	if _, ok := h.client[client]; ok {
-		client.connection.Close(websocket.StatusNormalClosure, "Connection closed normally")
+	_, ok := h.client[client]
+	room := client.room
+	if ok {
+		if client.connection != nil {
+			client.connection.Close(websocket.StatusNormalClosure, "Connection closed normally")
+		}
 		delete(h.client, client)
+		h.forgetDisplayName(client.id)
+	}
+	h.Unlock()
+
+	if !ok || room == "" {
+		return
+	}
+	if r, found := h.findRoom(room); found {
+		r.send(roomCommand{kind: commandDisconnect, client: client})
+	}
+}
+
+// setAwaitingReconnect records the room holding a disconnected player's seat.
+// An empty room clears it.
+func (h *Hub) setAwaitingReconnect(id, room string) {
+	h.Lock()
+	defer h.Unlock()
+	if room == "" {
+		delete(h.awaiting, id)
+		return
+	}
+	h.awaiting[id] = room
+}
+
+// awaitingReconnect returns the room holding a disconnected player's seat.
+func (h *Hub) awaitingReconnect(id string) (string, bool) {
+	h.RLock()
+	defer h.RUnlock()
+	room, ok := h.awaiting[id]
+	return room, ok
+}
+
+// clientRoom returns the room a client is in, "" for the lobby. Rooms and
+// bots change it from other goroutines, so it is only read through here.
+func (h *Hub) clientRoom(client *Client) string {
+	h.RLock()
+	defer h.RUnlock()
+	return client.room
+}
+
+// setRoom records the room a client is in.
+func (h *Hub) setRoom(client *Client, room string) {
+	h.Lock()
+	defer h.Unlock()
+	client.room = room
+}
+
+// clearRoom puts a client put out of room back in the lobby, unless it has
+// gone on to another room since.
+func (h *Hub) clearRoom(client *Client, room string) {
+	h.Lock()
+	defer h.Unlock()
+	if client.room == room {
+		client.room = ""
+	}
+}
+
+// room returns the room with the given name, creating it with the given
+// settings if needed.
+func (h *Hub) room(name string, settings RoomSettings) *Room {
+	h.Lock()
+	defer h.Unlock()
+	if r, ok := h.rooms[name]; ok {
+		return r
+	}
+	r := newRoom(name, h, settings)
+	h.rooms[name] = r
+	return r
+}
+
+// findRoom returns the room with the given name if it exists.
+func (h *Hub) findRoom(name string) (*Room, bool) {
+	h.RLock()
+	defer h.RUnlock()
+	r, ok := h.rooms[name]
+	return r, ok
+}
+
+// deleteRoom forgets a room that has shut down.
+func (h *Hub) deleteRoom(r *Room) {
+	h.Lock()
+	defer h.Unlock()
+	if h.rooms[r.name] == r {
+		delete(h.rooms, r.name)
 	}
 }
 
+// emitRoomList sends the room list to every client in the lobby.
+func (h *Hub) emitRoomList() error {
+	response := ListRoomResponse{Rooms: h.roomList()}
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("failed to marshal list room response: %v", err)
+	}
+
+	h.lobbyEmit(Event{
+		Type:    EventListRooms,
+		Payload: data,
+	})
+	return nil
+}
+
 // Send an event to a single client
 func emit(event Event, client *Client) {
-	client.egress <- event
+	select {
+	case client.egress <- event:
+	case <-client.done:
+	}
 }
 
-// Send an event to all connected clients
-// func broadcast(event Event, h *Hub) {
-// 	for client := range h.client {
-// 		client.egress <- event
-// 	}
-// }
-
-// Send an event to all clients in the same room
-func roomEmit(event Event, room string, h *Hub) {
+// Send an event to all clients that are not in a room. A client slow to read
+// must not hold up the hub, so the lock is let go before sending.
+func (h *Hub) lobbyEmit(event Event) {
+	h.RLock()
+	var clients []*Client
 	for client := range h.client {
-		if client.room == room {
-			client.egress <- event
+		if client.room == "" {
+			clients = append(clients, client)
 		}
 	}
+	h.RUnlock()
+
+	for _, client := range clients {
+		emit(event, client)
+	}
 }
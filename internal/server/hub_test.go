@@ -0,0 +1,694 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"prisoner-fencing/internal/database"
+	"prisoner-fencing/internal/engine"
+)
+
+// newTestClient registers a client without a websocket connection. Every
+// event sent to it is forwarded to the returned channel.
+func newTestClient(h *Hub, id string) (*Client, chan Event) {
+	c := NewClient(nil, h)
+	c.id = id
+	h.addClient(c)
+
+	received := make(chan Event, 256)
+	go func() {
+		for {
+			select {
+			case event := <-c.egress:
+				select {
+				case received <- event:
+				default: // Nobody is reading, drop it
+				}
+			case <-c.done:
+				return
+			}
+		}
+	}()
+	return c, received
+}
+
+// send routes an event with the given payload as if it came from c.
+func send(t *testing.T, c *Client, eventType string, payload any) error {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("failed to marshal payload: %v", err)
+	}
+	return c.hub.routeEvent(Event{Type: eventType, Payload: data}, c)
+}
+
+// waitFor reads events until one of the given type arrives.
+func waitFor(t *testing.T, received chan Event, eventType string) Event {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case event := <-received:
+			if event.Type == eventType {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", eventType)
+		}
+	}
+}
+
+func TestGameActionResolvesTurn(t *testing.T) {
+	h := NewHub()
+	c1, r1 := newTestClient(h, "p1")
+	c2, r2 := newTestClient(h, "p2")
+
+	if err := send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena"}); err != nil {
+		t.Fatalf("p1 failed to join: %v", err)
+	}
+	if err := send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"}); err != nil {
+		t.Fatalf("p2 failed to join: %v", err)
+	}
+	if err := send(t, c1, EventGameAction, map[string]string{"room": "arena", "action": "WAIT"}); err != nil {
+		t.Fatalf("p1 failed to act: %v", err)
+	}
+	if err := send(t, c2, EventGameAction, map[string]string{"room": "arena", "action": "ADVANCE"}); err != nil {
+		t.Fatalf("p2 failed to act: %v", err)
+	}
+
+	for _, tc := range []struct {
+		received   chan Event
+		youEnergy  int
+		youPlayer  int
+		opponentAt int
+	}{
+		{r1, 11, 1, 3},
+		{r2, 9, 2, 2},
+	} {
+		var gs GameState
+		for gs.Turn != 1 {
+			event := waitFor(t, tc.received, "GAME_ACTION_RESULT")
+			if err := json.Unmarshal(event.Payload, &gs); err != nil {
+				t.Fatalf("failed to unmarshal game state: %v", err)
+			}
+		}
+		you, opponent := gs.PlayerStates["you"], gs.PlayerStates["opponent"]
+		if you.Player != tc.youPlayer || you.Energy != tc.youEnergy {
+			t.Errorf("Expected player %d with energy %d, got %+v", tc.youPlayer, tc.youEnergy, you)
+		}
+		if opponent.Pos != tc.opponentAt {
+			t.Errorf("Expected opponent of player %d at %d, got %d", tc.youPlayer, tc.opponentAt, opponent.Pos)
+		}
+	}
+}
+
+func TestGameActionUnknownRoom(t *testing.T) {
+	h := NewHub()
+	c, received := newTestClient(h, "p1")
+
+	if err := send(t, c, EventGameAction, map[string]string{"room": "nowhere", "action": "WAIT"}); err == nil {
+		t.Errorf("Expected an error for a room that does not exist")
+	}
+	expectError(t, received, CodeRoomNotFound, EventGameAction)
+}
+
+// expectError waits for an error event and checks its code and failed event.
+func expectError(t *testing.T, received chan Event, code, eventType string) {
+	t.Helper()
+	var payload ErrorEvent
+	if err := json.Unmarshal(waitFor(t, received, EventError).Payload, &payload); err != nil {
+		t.Fatalf("failed to unmarshal error event: %v", err)
+	}
+	if payload.Code != code || payload.Event != eventType || payload.Message == "" {
+		t.Errorf("Expected a %s error for %s, got %+v", code, eventType, payload)
+	}
+}
+
+func TestErrorEvents(t *testing.T) {
+	h := NewHub()
+	c1, r1 := newTestClient(h, "p1")
+	c2, _ := newTestClient(h, "p2")
+	guest, rg := newTestClient(h, "")
+
+	send(t, guest, EventListRooms, nil)
+	expectError(t, rg, CodeNotInitialized, EventListRooms)
+
+	send(t, c1, "fly_away", nil)
+	expectError(t, r1, CodeUnknownEvent, "fly_away")
+
+	send(t, c1, EventJoinRoom, "arena")
+	expectError(t, r1, CodeBadRequest, EventJoinRoom)
+
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena", Settings: &RoomSettings{Ruleset: "chess"}})
+	expectError(t, r1, CodeInvalidSettings, EventJoinRoom)
+
+	send(t, c1, EventLeaveRoom, nil)
+	expectError(t, r1, CodeNotInRoom, EventLeaveRoom)
+
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	send(t, c1, EventGameAction, map[string]string{"room": "arena", "action": "DANCE"})
+	expectError(t, r1, CodeInvalidAction, EventGameAction)
+
+	send(t, c1, EventGameCommit, map[string]string{"room": "arena", "commitment": "abc"})
+	expectError(t, r1, CodeWrongPhase, EventGameCommit)
+}
+
+func TestEmptyRoomIsDeleted(t *testing.T) {
+	h := NewHub()
+	c, _ := newTestClient(h, "p1")
+
+	if err := send(t, c, EventJoinRoom, JoinRoomEvent{Room: "arena"}); err != nil {
+		t.Fatalf("failed to join: %v", err)
+	}
+	h.removeClient(c)
+
+	if _, ok := h.findRoom("arena"); ok {
+		t.Errorf("Expected room to be deleted after the last client left")
+	}
+}
+
+func TestLeaveRoomForfeits(t *testing.T) {
+	h := NewHub()
+	c1, _ := newTestClient(h, "p1")
+	c2, r2 := newTestClient(h, "p2")
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+
+	if err := send(t, c1, EventLeaveRoom, nil); err != nil {
+		t.Fatalf("failed to leave: %v", err)
+	}
+	if c1.room != "" {
+		t.Errorf("Expected leaving client to be back in the lobby, still in %q", c1.room)
+	}
+
+	var gs GameState
+	for !gs.GameOver {
+		event := waitFor(t, r2, "GAME_ACTION_RESULT")
+		if err := json.Unmarshal(event.Payload, &gs); err != nil {
+			t.Fatalf("failed to unmarshal game state: %v", err)
+		}
+	}
+	if gs.Winner != "Opponent left. You win!" {
+		t.Errorf("Expected remaining player to win by forfeit, got %q", gs.Winner)
+	}
+}
+
+func TestLeaveRoomWhileWaiting(t *testing.T) {
+	h := NewHub()
+	c1, r1 := newTestClient(h, "p1")
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+
+	if err := send(t, c1, EventLeaveRoom, nil); err != nil {
+		t.Fatalf("failed to leave: %v", err)
+	}
+	waitFor(t, r1, EventLeaveRoom)
+	if _, ok := h.findRoom("arena"); ok {
+		t.Errorf("Expected empty room to be deleted")
+	}
+	event := waitFor(t, r1, EventListRooms)
+	var rooms ListRoomResponse
+	if err := json.Unmarshal(event.Payload, &rooms); err != nil {
+		t.Fatalf("failed to unmarshal room list: %v", err)
+	}
+	if len(rooms.Rooms) != 0 {
+		t.Errorf("Expected no rooms to be listed, got %v", rooms.Rooms)
+	}
+}
+
+func TestReconnectWithinGrace(t *testing.T) {
+	h := NewHub()
+	c1, _ := newTestClient(h, "p1")
+	c2, _ := newTestClient(h, "p2")
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	send(t, c2, EventGameAction, map[string]string{"room": "arena", "action": "WAIT"})
+
+	h.removeClient(c2)
+	if room, ok := h.awaitingReconnect("p2"); !ok || room != "arena" {
+		t.Fatalf("Expected p2 to keep their seat in arena, got %q", room)
+	}
+
+	c3, r3 := newTestClient(h, "")
+	if err := send(t, c3, EventInitClient, InitClientEvent{Token: h.sessions.issue("p2", time.Now())}); err != nil {
+		t.Fatalf("failed to reconnect: %v", err)
+	}
+	if c3.room != "arena" {
+		t.Errorf("Expected reconnected client to be in arena, got %q", c3.room)
+	}
+	waitFor(t, r3, EventJoinRoom)
+	var gs GameState
+	if err := json.Unmarshal(waitFor(t, r3, "GAME_ACTION_RESULT").Payload, &gs); err != nil {
+		t.Fatalf("failed to unmarshal game state: %v", err)
+	}
+	if you := gs.PlayerStates["you"]; you.Player != 2 || you.Action != "WAIT" {
+		t.Errorf("Expected to be player 2 with the pending WAIT, got %+v", you)
+	}
+	// The turn carries on with the reconnected client
+	send(t, c1, EventGameAction, map[string]string{"room": "arena", "action": "WAIT"})
+	for gs.Turn != 1 {
+		if err := json.Unmarshal(waitFor(t, r3, "GAME_ACTION_RESULT").Payload, &gs); err != nil {
+			t.Fatalf("failed to unmarshal game state: %v", err)
+		}
+	}
+}
+
+func TestDisconnectForfeitsAfterGrace(t *testing.T) {
+	h := NewHub()
+	h.reconnectGrace = 50 * time.Millisecond
+	c1, r1 := newTestClient(h, "p1")
+	c2, _ := newTestClient(h, "p2")
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+
+	h.removeClient(c2)
+
+	var gs GameState
+	for !gs.GameOver {
+		if err := json.Unmarshal(waitFor(t, r1, "GAME_ACTION_RESULT").Payload, &gs); err != nil {
+			t.Fatalf("failed to unmarshal game state: %v", err)
+		}
+	}
+	if gs.Reason != ReasonDisconnect || gs.Winner != "Opponent disconnected. You win!" {
+		t.Errorf("Expected a win by disconnect, got %q (%s)", gs.Winner, gs.Reason)
+	}
+	if _, ok := h.awaitingReconnect("p2"); ok {
+		t.Errorf("Expected p2 to lose their seat after the grace period")
+	}
+}
+
+func TestTurnTimerPlaysTimeoutAction(t *testing.T) {
+	h := NewHub()
+	c1, r1 := newTestClient(h, "p1")
+	c2, _ := newTestClient(h, "p2")
+	settings := &RoomSettings{Timer: TurnTimer{Seconds: 1, Action: "WAIT", Penalty: 2}}
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena", Settings: settings})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+
+	var gs GameState
+	for gs.PlayerStates["opponent"].Player == 0 {
+		if err := json.Unmarshal(waitFor(t, r1, "GAME_ACTION_RESULT").Payload, &gs); err != nil {
+			t.Fatalf("failed to unmarshal game state: %v", err)
+		}
+	}
+	if gs.TimeLeft <= 0 || gs.TimeLeft > 1000 {
+		t.Errorf("Expected up to a second left to act, got %dms", gs.TimeLeft)
+	}
+
+	send(t, c1, EventGameAction, map[string]string{"room": "arena", "action": "ADVANCE"})
+	for gs.Turn != 1 {
+		if err := json.Unmarshal(waitFor(t, r1, "GAME_ACTION_RESULT").Payload, &gs); err != nil {
+			t.Fatalf("failed to unmarshal game state: %v", err)
+		}
+	}
+	if opponent := gs.PlayerStates["opponent"]; opponent.Action != "WAIT" || opponent.Energy != 9 {
+		t.Errorf("Expected timed out opponent to WAIT with a 2 energy penalty, got %+v", opponent)
+	}
+	if you := gs.PlayerStates["you"]; you.Energy != 9 {
+		t.Errorf("Expected player who acted in time to pay only for the advance, got %+v", you)
+	}
+}
+
+func TestTimeoutPenaltyRecordedInTurn(t *testing.T) {
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	h := newSeriesHub()
+	h.db = db
+	c1, r1 := newTestClient(h, "p1")
+	c2, _ := newTestClient(h, "p2")
+	settings := &RoomSettings{Ruleset: "short", Timer: TurnTimer{Seconds: 1, Action: "WAIT", Penalty: 2}}
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena", Settings: settings})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	send(t, c1, EventGameAction, map[string]string{"room": "arena", "action": "WAIT"})
+	waitForState(t, r1, func(gs GameState) bool { return gs.GameOver })
+
+	m, err := db.GetMatch(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Expected the match to be stored: %v", err)
+	}
+	initial := engine.DefaultRuleset().StartEnergy
+	if p2 := m.Turns[0].Players[1]; p2.Before.Energy != initial || p2.After.Energy != initial-1 {
+		t.Errorf("Expected the penalty between the states before and after the turn, got %+v", p2)
+	}
+}
+
+func TestCommitReveal(t *testing.T) {
+	h := NewHub()
+	c1, r1 := newTestClient(h, "p1")
+	c2, r2 := newTestClient(h, "p2")
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena", Settings: &RoomSettings{CommitReveal: true}})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+
+	if err := send(t, c1, EventGameAction, map[string]string{"room": "arena", "action": "WAIT"}); err == nil {
+		t.Errorf("Expected plaintext actions to be rejected in a commit-reveal room")
+	}
+	if err := send(t, c1, EventGameReveal, map[string]string{"room": "arena", "action": "WAIT", "nonce": "a"}); err == nil {
+		t.Errorf("Expected a reveal before both commits to be rejected")
+	}
+
+	expectError(t, r1, CodeWrongPhase, EventGameAction)
+	expectError(t, r1, CodeWrongPhase, EventGameReveal)
+
+	// A malformed commitment is rejected, and does not use up the turn's commit
+	for _, commitment := range []string{"", "abc", strings.ToUpper(engine.Commitment("WAIT", "n1"))} {
+		send(t, c1, EventGameCommit, map[string]string{"room": "arena", "commitment": commitment})
+		expectError(t, r1, CodeInvalidPayload, EventGameCommit)
+	}
+
+	send(t, c1, EventGameCommit, map[string]string{"room": "arena", "commitment": engine.Commitment("WAIT", "n1")})
+	send(t, c2, EventGameCommit, map[string]string{"room": "arena", "commitment": engine.Commitment("ADVANCE", "n2")})
+	waitFor(t, r1, "REVEAL_ACTIONS")
+	waitFor(t, r2, "REVEAL_ACTIONS")
+
+	if err := send(t, c2, EventGameReveal, map[string]string{"room": "arena", "action": "ATTACK", "nonce": "n2"}); err == nil {
+		t.Errorf("Expected a reveal that does not match the commitment to be rejected")
+	}
+	send(t, c1, EventGameReveal, map[string]string{"room": "arena", "action": "WAIT", "nonce": "n1"})
+	send(t, c2, EventGameReveal, map[string]string{"room": "arena", "action": "ADVANCE", "nonce": "n2"})
+
+	var gs GameState
+	for gs.Turn != 1 {
+		if err := json.Unmarshal(waitFor(t, r1, "GAME_ACTION_RESULT").Payload, &gs); err != nil {
+			t.Fatalf("failed to unmarshal game state: %v", err)
+		}
+	}
+	opponent := gs.PlayerStates["opponent"]
+	if opponent.Action != "ADVANCE" || !engine.VerifyReveal(opponent.Commitment, opponent.Action, opponent.Nonce) {
+		t.Errorf("Expected the result to carry an auditable reveal, got %+v", opponent)
+	}
+}
+
+func TestCommitRevealReplay(t *testing.T) {
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	h := newSeriesHub()
+	h.db = db
+	c1, r1 := newTestClient(h, "p1")
+	c2, _ := newTestClient(h, "p2")
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena", Settings: &RoomSettings{Ruleset: "short", CommitReveal: true}})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	send(t, c1, EventGameCommit, map[string]string{"room": "arena", "commitment": engine.Commitment("WAIT", "n1")})
+	send(t, c2, EventGameCommit, map[string]string{"room": "arena", "commitment": engine.Commitment("ADVANCE", "n2")})
+	send(t, c1, EventGameReveal, map[string]string{"room": "arena", "action": "WAIT", "nonce": "n1"})
+	send(t, c2, EventGameReveal, map[string]string{"room": "arena", "action": "ADVANCE", "nonce": "n2"})
+	waitForState(t, r1, func(gs GameState) bool { return gs.GameOver })
+
+	m, err := db.GetMatch(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Expected the match to be stored: %v", err)
+	}
+	replay := newReplay(m)
+	if len(replay.Turns) != 1 || len(replay.Turns[0].Commitments) != 2 || len(replay.Turns[0].Nonces) != 2 {
+		t.Fatalf("Expected the replay to carry each player's commitment and nonce, got %+v", replay.Turns)
+	}
+	turn := replay.Turns[0]
+	for i, action := range turn.Actions {
+		sum := sha256.Sum256([]byte(string(action) + ":" + turn.Nonces[i]))
+		if turn.Commitments[i] != hex.EncodeToString(sum[:]) {
+			t.Errorf("Expected P%d's commitment to be SHA-256(%s:%s), got %s", i+1, action, turn.Nonces[i], turn.Commitments[i])
+		}
+	}
+}
+
+func TestTieBreakSubmissionOrder(t *testing.T) {
+	h := NewHub()
+	c1, r1 := newTestClient(h, "p1")
+	c2, _ := newTestClient(h, "p2")
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+
+	// Player 2 chooses first, so takes the contested square
+	send(t, c2, EventGameAction, map[string]string{"room": "arena", "action": "ADVANCE"})
+	send(t, c1, EventGameAction, map[string]string{"room": "arena", "action": "ADVANCE"})
+
+	var gs GameState
+	for gs.Turn != 1 {
+		if err := json.Unmarshal(waitFor(t, r1, "GAME_ACTION_RESULT").Payload, &gs); err != nil {
+			t.Fatalf("failed to unmarshal game state: %v", err)
+		}
+	}
+	if you, opponent := gs.PlayerStates["you"], gs.PlayerStates["opponent"]; you.Pos != 2 || opponent.Pos != 3 {
+		t.Errorf("Expected player 2 to take square 3, got positions %d and %d", you.Pos, opponent.Pos)
+	}
+	if gs.TieBreak != TieBreakSubmission || !strings.Contains(gs.LastAction, "Tie-break: submission order.") {
+		t.Errorf("Expected the submission order policy in the log, got %q (%s)", gs.LastAction, gs.TieBreak)
+	}
+}
+
+func TestUnknownTieBreakRejected(t *testing.T) {
+	h := NewHub()
+	c, _ := newTestClient(h, "p1")
+
+	if err := send(t, c, EventJoinRoom, JoinRoomEvent{Room: "arena", Settings: &RoomSettings{TieBreak: "arm-wrestle"}}); err == nil {
+		t.Errorf("Expected an unknown tie-break policy to be rejected")
+	}
+}
+
+func TestBotFillsSecondSeat(t *testing.T) {
+	for _, commitReveal := range []bool{false, true} {
+		h := NewHub()
+		c, received := newTestClient(h, "p1")
+		settings := &RoomSettings{Bot: "heuristic", CommitReveal: commitReveal}
+		if err := send(t, c, EventJoinRoom, JoinRoomEvent{Room: "arena", Settings: settings}); err != nil {
+			t.Fatalf("failed to join room: %v", err)
+		}
+
+		// Wait for the bot to sit down
+		var gs GameState
+		for gs.PlayerStates["opponent"].Player != 2 {
+			if err := json.Unmarshal(waitFor(t, received, "GAME_ACTION_RESULT").Payload, &gs); err != nil {
+				t.Fatalf("failed to unmarshal game state: %v", err)
+			}
+		}
+
+		if commitReveal {
+			send(t, c, EventGameCommit, map[string]string{"room": "arena", "commitment": engine.Commitment("WAIT", "n1")})
+			waitFor(t, received, "REVEAL_ACTIONS")
+			send(t, c, EventGameReveal, map[string]string{"room": "arena", "action": "WAIT", "nonce": "n1"})
+		} else {
+			send(t, c, EventGameAction, map[string]string{"room": "arena", "action": "WAIT"})
+		}
+		for gs.Turn != 1 {
+			if err := json.Unmarshal(waitFor(t, received, "GAME_ACTION_RESULT").Payload, &gs); err != nil {
+				t.Fatalf("failed to unmarshal game state: %v", err)
+			}
+		}
+		if opponent := gs.PlayerStates["opponent"]; opponent.Action != engine.ActionAdvance || opponent.Name != "Bot (heuristic)" {
+			t.Errorf("Expected the heuristic bot to advance, got %+v", opponent)
+		}
+
+		// Once the game is over the bot leaves, and the room goes with it
+		send(t, c, EventLeaveRoom, nil)
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if _, ok := h.findRoom("arena"); !ok {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected the room to be deleted after the bot left")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestUnknownBotRejected(t *testing.T) {
+	h := NewHub()
+	c, _ := newTestClient(h, "p1")
+
+	if err := send(t, c, EventJoinRoom, JoinRoomEvent{Room: "arena", Settings: &RoomSettings{Bot: "grandmaster"}}); err == nil {
+		t.Errorf("Expected an unknown bot strength to be rejected")
+	}
+}
+
+func TestFinishedGameIsSaved(t *testing.T) {
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	h := NewHub()
+	h.db = db
+
+	c1, r1 := newTestClient(h, "p1")
+	c2, _ := newTestClient(h, "p2")
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	send(t, c1, EventGameAction, map[string]string{"room": "arena", "action": "WAIT"})
+	send(t, c2, EventGameAction, map[string]string{"room": "arena", "action": "ADVANCE"})
+	send(t, c2, EventLeaveRoom, nil)
+
+	var gs GameState
+	for !gs.GameOver {
+		if err := json.Unmarshal(waitFor(t, r1, "GAME_ACTION_RESULT").Payload, &gs); err != nil {
+			t.Fatalf("failed to unmarshal game state: %v", err)
+		}
+	}
+
+	matches, err := db.ListMatchesByPlayer(context.Background(), "p1", 10)
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("Expected 1 saved match, got %d (%v)", len(matches), err)
+	}
+	m, err := db.GetMatch(context.Background(), matches[0].ID)
+	if err != nil {
+		t.Fatalf("failed to get match: %v", err)
+	}
+	if m.Winner != 1 || m.Reason != ReasonForfeit || m.Ruleset != engine.DefaultRulesetName || !m.Rated {
+		t.Errorf("Expected a forfeit win for player 1, got %+v", m)
+	}
+	if len(m.Turns) != 1 || m.Turns[0].Actions != [2]engine.Action{"WAIT", "ADVANCE"} || len(m.Turns[0].Outcomes) != 2 {
+		t.Errorf("Expected the played turn to be saved, got %+v", m.Turns)
+	}
+	if p2 := m.Turns[0].Players[1]; p2.Before.Pos != 4 || p2.After.Pos != 3 || p2.After.Energy != 9 || !p2.After.Advanced {
+		t.Errorf("Expected player 2's state either side of the turn, got %+v", p2)
+	}
+	if len(m.Participants) != 2 || m.Participants[1].PlayerId != "p2" || m.Participants[1].FinalEnergy != 9 {
+		t.Errorf("Expected both participants, got %+v", m.Participants)
+	}
+}
+
+// TestConcurrentClients hammers the hub from many goroutines. Run it with
+// -race to check that all shared state is synchronized.
+func TestConcurrentClients(t *testing.T) {
+	h := NewHub()
+	h.reconnectGrace = 0
+	actions := []string{"WAIT", "RETREAT", "ADVANCE", "ATTACK", "COUNTER"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, _ := newTestClient(h, fmt.Sprintf("player-%d", i))
+			room := fmt.Sprintf("room-%d", i/2)
+
+			send(t, c, EventListRooms, ListRoomEvent{})
+			send(t, c, EventJoinRoom, JoinRoomEvent{Room: room})
+			for turn := 0; turn < 25; turn++ {
+				send(t, c, EventGameAction, map[string]string{"room": room, "action": actions[(i+turn)%len(actions)]})
+				send(t, c, EventSendMessage, SendMessageEvent{Message: "hi", From: c.id})
+			}
+			// Hop to a shared room before leaving
+			send(t, c, EventJoinRoom, JoinRoomEvent{Room: "shared"})
+			h.removeClient(c)
+		}(i)
+	}
+	wg.Wait()
+
+	h.RLock()
+	defer h.RUnlock()
+	if len(h.client) != 0 || len(h.rooms) != 0 {
+		t.Errorf("Expected no clients or rooms left, got %d clients and %d rooms", len(h.client), len(h.rooms))
+	}
+}
+
+func TestSlowClientDoesNotHoldHub(t *testing.T) {
+	h := NewHub()
+	// Nothing reads what the stuck client is sent
+	stuck := NewClient(nil, h)
+	h.addClient(stuck)
+	defer stuck.close()
+	c1, _ := newTestClient(h, "p1")
+	go h.lobbyEmit(Event{Type: EventNewMessage})
+	go h.playerEmit("", Event{Type: EventNewMessage})
+	time.Sleep(10 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		h.setRoom(c1, "arena")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the hub to be free while a client is slow to read")
+	}
+}
+
+func TestEventIdsEchoed(t *testing.T) {
+	h := NewHub()
+	c1, r1 := newTestClient(h, "p1")
+	c2, _ := newTestClient(h, "p2")
+
+	route := func(c *Client, eventType, id string, payload any) {
+		data, _ := json.Marshal(payload)
+		h.routeEvent(Event{Type: eventType, Payload: data, ID: id}, c)
+	}
+	route(c1, EventListRooms, "1", nil)
+	if event := waitFor(t, r1, EventListRooms); event.ID != "1" {
+		t.Errorf("Expected list_rooms reply with id 1, got %q", event.ID)
+	}
+	route(c1, EventJoinRoom, "2", JoinRoomEvent{Room: "arena"})
+	if event := waitFor(t, r1, EventJoinRoom); event.ID != "2" {
+		t.Errorf("Expected join_room reply with id 2, got %q", event.ID)
+	}
+	route(c2, EventJoinRoom, "", JoinRoomEvent{Room: "arena"})
+
+	route(c1, EventGameAction, "3", map[string]string{"room": "arena", "action": "WAIT"})
+	event := waitFor(t, r1, EventAck)
+	var ack AckEvent
+	json.Unmarshal(event.Payload, &ack)
+	if event.ID != "3" || ack.Event != EventGameAction {
+		t.Errorf("Expected game_action ack with id 3, got %q for %+v", event.ID, ack)
+	}
+
+	route(c1, EventGameAction, "4", map[string]string{"room": "arena", "action": "DANCE"})
+	if event := waitFor(t, r1, EventError); event.ID != "4" {
+		t.Errorf("Expected error with id 4, got %q", event.ID)
+	}
+}
+
+func TestGameActionRejected(t *testing.T) {
+	h := NewHub()
+	c1, r1 := newTestClient(h, "p1")
+	c2, _ := newTestClient(h, "p2")
+	spectator, rs := newTestClient(h, "p3")
+	lobby, rl := newTestClient(h, "p4")
+	for _, c := range []*Client{c1, c2, spectator} {
+		send(t, c, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	}
+	act := func(c *Client, action string) error {
+		return send(t, c, EventGameAction, map[string]string{"room": "arena", "action": action})
+	}
+
+	act(c1, "FLY")
+	expectError(t, r1, CodeInvalidAction, EventGameAction)
+	act(spectator, "WAIT")
+	expectError(t, rs, CodeNotSeated, EventGameAction)
+	act(lobby, "WAIT")
+	expectError(t, rl, CodeNotInRoom, EventGameAction)
+
+	if err := act(c1, "WAIT"); err != nil {
+		t.Fatalf("p1 failed to act: %v", err)
+	}
+	act(c1, "ATTACK")
+	expectError(t, r1, CodeAlreadySubmitted, EventGameAction)
+
+	send(t, c2, EventLeaveRoom, nil)
+	act(c1, "WAIT")
+	expectError(t, r1, CodeGameOver, EventGameAction)
+}
+
+func TestUnknownTimeoutActionRejected(t *testing.T) {
+	h := NewHub()
+	c, _ := newTestClient(h, "p1")
+
+	settings := &RoomSettings{Timer: TurnTimer{Seconds: 5, Action: "NAP"}}
+	if err := send(t, c, EventJoinRoom, JoinRoomEvent{Room: "arena", Settings: settings}); err == nil {
+		t.Errorf("Expected an unknown timeout action to be rejected")
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"prisoner-fencing/internal/database"
+	"prisoner-fencing/internal/engine"
+)
+
+// saveTimeout bounds how long a room waits for its match to be stored.
+const saveTimeout = 5 * time.Second
+
+// saveMatch stores the game that just ended in the hub's database, and
+// returns its id or 0 if it was not stored. Games that never had two players
+// are not matches and are dropped.
+func (r *Room) saveMatch(result engine.Result, reason string) int64 {
+	gs := r.state
+	ids, full := gs.seats()
+	if r.hub.db == nil || !full || gs.startedAt.IsZero() {
+		return 0
+	}
+
+	m := database.Match{
+		Room:      r.name,
+		Ruleset:   gs.Ruleset.Name,
+		Rules:     gs.Ruleset,
+		StartedAt: gs.startedAt,
+		EndedAt:   time.Now(),
+		Winner:    result.Winner,
+		Reason:    reason,
+		Rated:     !r.settings.Casual,
+		TurnCount: len(gs.history),
+		Turns:     gs.history,
+	}
+	for client, id := range r.clients {
+		if client.bot && (id == ids[0] || id == ids[1]) {
+			m.Rated = false
+		}
+	}
+	for i, id := range ids {
+		ps := gs.PlayerStates[id]
+		m.Participants = append(m.Participants, database.Participant{Seat: i + 1, PlayerId: id, FinalPos: ps.Pos, FinalEnergy: ps.Energy})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+	defer cancel()
+	id, err := r.hub.db.SaveMatch(ctx, m)
+	if err != nil {
+		log.Printf("Failed to save match in room %s: %v", r.name, err)
+	}
+	return id
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"prisoner-fencing/internal/rating"
+)
+
+// Matchmaking pairs the players in the queue whose ratings are within the
+// window of whoever has waited longest. The window starts at matchWindow and
+// widens by matchWindowGrowth for every matchWindowStep waited.
+const (
+	matchWindow       = 100
+	matchWindowGrowth = 50
+	matchWindowStep   = 5 * time.Second
+	// matchInterval is how often a queue with players in it is checked.
+	matchInterval = time.Second
+	// matchJoinTimeout is how long matched players have to join their room
+	// before the match is called off.
+	matchJoinTimeout = 30 * time.Second
+)
+
+// matchRoomPrefix starts the name of every room the matchmaker creates.
+// Joining one that does not exist does not create it.
+const matchRoomPrefix = "match-"
+
+// queueEntry is a player waiting for a match.
+type queueEntry struct {
+	client   *Client
+	id       string
+	name     string
+	rating   int
+	joinedAt time.Time
+}
+
+// window returns the rating difference the player accepts at now.
+func (e *queueEntry) window(now time.Time) int {
+	return matchWindow + matchWindowGrowth*int(now.Sub(e.joinedAt)/matchWindowStep)
+}
+
+// matchmaker keeps the queue of players looking for a game.
+type matchmaker struct {
+	hub *Hub
+	sync.Mutex
+	queue []*queueEntry // in the order players joined
+	timer *time.Timer   // runs tick while the queue is not empty
+	now   func() time.Time
+}
+
+func newMatchmaker(h *Hub) *matchmaker {
+	return &matchmaker{hub: h, now: time.Now}
+}
+
+// QueueStatusEvent is the payload of the reply to queue_join and queue_leave.
+type QueueStatusEvent struct {
+	Queued  bool `json:"queued"`
+	Rating  int  `json:"rating,omitempty"`
+	Waiting int  `json:"waiting"` // players in the queue
+}
+
+// MatchFoundEvent tells a player who they were paired with and the room to
+// join for the game.
+type MatchFoundEvent struct {
+	Room     string `json:"room"`
+	Opponent string `json:"opponent"` // player id
+	Name     string `json:"name"`     // display name of the opponent
+	Rating   int    `json:"rating"`   // of the opponent
+}
+
+func QueueJoinHandler(event Event, c *Client) error {
+	if current := c.hub.clientRoom(c); current != "" {
+		return handlerError(CodeWrongPhase, "leave room %s before joining the queue", current)
+	}
+	entry := &queueEntry{client: c, id: c.id, name: c.hub.displayName(c.id), rating: c.hub.rating(c.id)}
+	if err := c.hub.matchmaker.join(entry); err != nil {
+		return err
+	}
+	return emitQueueStatus(event, c, true, entry.rating)
+}
+
+func QueueLeaveHandler(event Event, c *Client) error {
+	if !c.hub.matchmaker.leave(c) {
+		return handlerError(CodeNotQueued, "client is not in the queue")
+	}
+	return emitQueueStatus(event, c, false, 0)
+}
+
+// emitQueueStatus replies to a queue event.
+func emitQueueStatus(event Event, c *Client, queued bool, rating int) error {
+	c.hub.matchmaker.Lock()
+	waiting := len(c.hub.matchmaker.queue)
+	c.hub.matchmaker.Unlock()
+
+	data, err := json.Marshal(QueueStatusEvent{Queued: queued, Rating: rating, Waiting: waiting})
+	if err != nil {
+		return fmt.Errorf("failed to marshal queue status: %v", err)
+	}
+	emit(Event{Type: event.Type, Payload: data, ID: event.ID}, c)
+	return nil
+}
+
+// rating returns the current rating of player id, the initial one if it
+// cannot be looked up.
+func (h *Hub) rating(id string) int {
+	if h.db == nil {
+		return rating.Initial
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	r, err := h.db.GetRating(ctx, id)
+	if err != nil {
+		log.Printf("Failed to get rating of %s: %v", id, err)
+		return rating.Initial
+	}
+	return r.Rating
+}
+
+// join puts a player in the queue and pairs them straight away if it can.
+func (m *matchmaker) join(e *queueEntry) error {
+	m.Lock()
+	for _, queued := range m.queue {
+		if queued.id == e.id {
+			m.Unlock()
+			return handlerError(CodeAlreadyQueued, "player is already in the queue")
+		}
+	}
+	e.joinedAt = m.now()
+	m.queue = append(m.queue, e)
+	m.Unlock()
+
+	m.tick()
+	return nil
+}
+
+// leave takes client c out of the queue, and reports whether it was in it.
+func (m *matchmaker) leave(c *Client) bool {
+	m.Lock()
+	defer m.Unlock()
+	for i, e := range m.queue {
+		if e.client == c {
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// tick pairs whoever it can and starts their games, and checks again later
+// while anyone is left waiting.
+func (m *matchmaker) tick() {
+	m.Lock()
+	pairs := m.match(m.now())
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+	if len(m.queue) > 0 {
+		m.timer = time.AfterFunc(matchInterval, m.tick)
+	}
+	m.Unlock()
+
+	for _, pair := range pairs {
+		m.hub.startMatch(pair)
+	}
+}
+
+// match takes the pairs it can make at now out of the queue. The caller must
+// hold the lock.
+func (m *matchmaker) match(now time.Time) [][2]*queueEntry {
+	var pairs [][2]*queueEntry
+	matched := make(map[*queueEntry]bool)
+	for i, a := range m.queue {
+		if matched[a] {
+			continue
+		}
+		var best *queueEntry
+		for _, b := range m.queue[i+1:] {
+			diff := ratingGap(a, b)
+			if matched[b] || diff > a.window(now) {
+				continue
+			}
+			if best == nil || diff < ratingGap(a, best) {
+				best = b
+			}
+		}
+		if best != nil {
+			matched[a], matched[best] = true, true
+			pairs = append(pairs, [2]*queueEntry{a, best})
+		}
+	}
+
+	queue := m.queue[:0]
+	for _, e := range m.queue {
+		if !matched[e] {
+			queue = append(queue, e)
+		}
+	}
+	clear(m.queue[len(queue):])
+	m.queue = queue
+	return pairs
+}
+
+// ratingGap returns how far apart the ratings of a and b are.
+func ratingGap(a, b *queueEntry) int {
+	if a.rating > b.rating {
+		return a.rating - b.rating
+	}
+	return b.rating - a.rating
+}
+
+// startMatch creates a room only the paired players may join, and tells them
+// to join it.
+func (h *Hub) startMatch(pair [2]*queueEntry) {
+	settings := h.defaultSettings
+	settings.players = [2]string{pair[0].id, pair[1].id}
+	settings.Visibility = VisibilityPrivate
+	if err := settings.normalize(h); err != nil {
+		log.Printf("Failed to create match room: %v", err)
+		return
+	}
+	name := matchRoomPrefix + randomHex(8)
+	h.room(name, settings)
+
+	for i, e := range pair {
+		opponent := pair[1-i]
+		data, err := json.Marshal(MatchFoundEvent{Room: name, Opponent: opponent.id, Name: opponent.name, Rating: opponent.rating})
+		if err != nil {
+			log.Printf("Failed to marshal match found event: %v", err)
+			continue
+		}
+		emit(Event{Type: EventMatchFound, Payload: data}, e.client)
+	}
+}
+
+// reserved reports whether the room's seats are kept for a matched pair.
+func (r *Room) reserved() bool {
+	return r.settings.players[0] != ""
+}
+
+// awaitingMatch reports whether the room is kept for matched players who have
+// not both sat down yet, and have not run out of time to.
+func (r *Room) awaitingMatch() bool {
+	if !r.reserved() || r.gameOver || r.calledOff {
+		return false
+	}
+	if r.state == nil {
+		return true
+	}
+	_, full := r.state.seats()
+	return !full
+}
+
+// callOffMatch tells whoever turned up to a matched game that has not started
+// in time that it is off. The room closes once they leave. Tournament matches
+// have a deadline of their own, see forfeitNoShow.
+func (r *Room) callOffMatch(now time.Time) {
+	if !r.awaitingMatch() || r.settings.tournamentId != "" || now.Before(r.created.Add(matchJoinTimeout)) {
+		return
+	}
+	r.calledOff = true
+	r.emit(Event{
+		Type:    EventMatchCancelled,
+		Payload: json.RawMessage(fmt.Sprintf(`{"room": "%s", "status": "Opponent did not join, the match is off"}`, r.name)),
+	})
+}
+
+// randomHex returns n random bytes in hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
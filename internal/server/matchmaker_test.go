@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// waitForMatch waits for a match_found event.
+func waitForMatch(t *testing.T, received chan Event) MatchFoundEvent {
+	t.Helper()
+	var found MatchFoundEvent
+	if err := json.Unmarshal(waitFor(t, received, EventMatchFound).Payload, &found); err != nil {
+		t.Fatalf("failed to unmarshal match found event: %v", err)
+	}
+	return found
+}
+
+// queued returns the number of players in the queue.
+func queued(h *Hub) int {
+	h.matchmaker.Lock()
+	defer h.matchmaker.Unlock()
+	return len(h.matchmaker.queue)
+}
+
+func TestQueuePairsPlayers(t *testing.T) {
+	h := NewHub()
+	c1, r1 := newTestClient(h, "p1")
+	c2, r2 := newTestClient(h, "p2")
+	other, ro := newTestClient(h, "p3")
+
+	for _, c := range []*Client{c1, c2} {
+		if err := send(t, c, EventQueueJoin, nil); err != nil {
+			t.Fatalf("Failed to queue: %v", err)
+		}
+	}
+	found1, found2 := waitForMatch(t, r1), waitForMatch(t, r2)
+	if found1.Room != found2.Room || found1.Opponent != "p2" || found2.Opponent != "p1" {
+		t.Fatalf("Expected p1 and p2 matched in one room, got %+v and %+v", found1, found2)
+	}
+	if rooms := h.roomList(); len(rooms) != 0 {
+		t.Errorf("Expected the match room to be left out of the room list, got %v", rooms)
+	}
+
+	send(t, other, EventJoinRoom, JoinRoomEvent{Room: found1.Room})
+	expectError(t, ro, CodeNoSeat, EventJoinRoom)
+
+	if err := send(t, c1, EventJoinRoom, JoinRoomEvent{Room: found1.Room}); err != nil {
+		t.Fatalf("p1 failed to join: %v", err)
+	}
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: found1.Room})
+	gs := waitForState(t, r1, func(gs GameState) bool { return len(gs.PlayerStates) == 2 })
+	if gs.PlayerStates["opponent"].Name != "p2" {
+		t.Errorf("Expected to face p2, got %+v", gs.PlayerStates)
+	}
+}
+
+func TestQueueWindowWidens(t *testing.T) {
+	h := NewHub()
+	now := time.Now()
+	h.matchmaker.now = func() time.Time { return now }
+	c1, r1 := newTestClient(h, "p1")
+	c2, _ := newTestClient(h, "p2")
+	c3, _ := newTestClient(h, "p3")
+
+	h.matchmaker.join(&queueEntry{client: c1, id: "p1", rating: 1500})
+	h.matchmaker.join(&queueEntry{client: c2, id: "p2", rating: 1720})
+	h.matchmaker.join(&queueEntry{client: c3, id: "p3", rating: 1900})
+
+	h.matchmaker.Lock()
+	if pairs := h.matchmaker.match(now); len(pairs) != 0 {
+		t.Errorf("Expected nobody within 100 of each other to be paired, got %d pairs", len(pairs))
+	}
+	// 15 seconds widens p1's window to 250, enough for p2 but not p3
+	pairs := h.matchmaker.match(now.Add(15 * time.Second))
+	h.matchmaker.Unlock()
+	if len(pairs) != 1 || pairs[0][0].id != "p1" || pairs[0][1].id != "p2" {
+		t.Fatalf("Expected p1 paired with p2, got %d pairs", len(pairs))
+	}
+	h.startMatch(pairs[0])
+	if found := waitForMatch(t, r1); found.Opponent != "p2" || found.Rating != 1720 {
+		t.Errorf("Expected p2 rated 1720 as the opponent, got %+v", found)
+	}
+	if h.matchmaker.leave(c3); queued(h) != 0 {
+		t.Errorf("Expected the queue to be empty, got %d", queued(h))
+	}
+}
+
+func TestQueueStaysConsistent(t *testing.T) {
+	h := NewHub()
+	c1, r1 := newTestClient(h, "p1")
+	c2, r2 := newTestClient(h, "p2")
+
+	send(t, c1, EventQueueJoin, nil)
+	send(t, c1, EventQueueJoin, nil)
+	expectError(t, r1, CodeAlreadyQueued, EventQueueJoin)
+	if err := send(t, c1, EventQueueLeave, nil); err != nil {
+		t.Errorf("Failed to leave the queue: %v", err)
+	}
+	send(t, c1, EventQueueLeave, nil)
+	expectError(t, r1, CodeNotQueued, EventQueueLeave)
+
+	// A player who drops out of the queue is not matched
+	send(t, c1, EventQueueJoin, nil)
+	h.removeClient(c1)
+	send(t, c2, EventQueueJoin, nil)
+	var status QueueStatusEvent
+	json.Unmarshal(waitFor(t, r2, EventQueueJoin).Payload, &status)
+	if !status.Queued || status.Waiting != 1 {
+		t.Errorf("Expected p2 alone in the queue, got %+v", status)
+	}
+
+	// Joining a room leaves the queue, and nobody queues from a room
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	if queued(h) != 0 {
+		t.Errorf("Expected joining a room to leave the queue")
+	}
+	send(t, c2, EventQueueJoin, nil)
+	expectError(t, r2, CodeWrongPhase, EventQueueJoin)
+}
+
+func TestMatchCalledOff(t *testing.T) {
+	h := NewHub()
+	c1, r1 := newTestClient(h, "p1")
+	c2, _ := newTestClient(h, "p2")
+
+	h.startMatch([2]*queueEntry{{client: c1, id: "p1"}, {client: c2, id: "p2"}})
+	found := waitForMatch(t, r1)
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: found.Room})
+
+	// The room is idle, so the test may act as its goroutine
+	room, _ := h.findRoom(found.Room)
+	room.callOffMatch(time.Now().Add(matchJoinTimeout))
+	var cancelled struct{ Room string }
+	json.Unmarshal(waitFor(t, r1, EventMatchCancelled).Payload, &cancelled)
+	if cancelled.Room != found.Room {
+		t.Errorf("Expected match in %s called off, got %s", found.Room, cancelled.Room)
+	}
+}
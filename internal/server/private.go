@@ -0,0 +1,66 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+)
+
+// Private rooms are left out of the room list, and can only be joined with
+// the password their owner chose. Invite rooms are the same, except the
+// server makes up an invite code and tells it to the owner when they join.
+// The owner and players already seated need neither, and rooms kept for a
+// matched pair only let that pair in anyway.
+
+// JoinRoomResponse is the payload of the reply to join_room.
+type JoinRoomResponse struct {
+	Room string `json:"room"`
+	// Invite is the invite code of an invite room, sent to its owner
+	Invite string `json:"invite,omitempty"`
+}
+
+// listed reports whether the room shows up in the room list.
+func (s *RoomSettings) listed() bool {
+	return s.Visibility == VisibilityPublic
+}
+
+// admits reports whether client c, player id, may join the room with key, the
+// password or invite code they gave.
+func (r *Room) admits(c *Client, id, key string) bool {
+	if c.bot || id == r.settings.owner || r.reserved() {
+		return true
+	}
+	if r.state != nil {
+		if _, seated := r.state.PlayerStates[id]; seated {
+			return true
+		}
+	}
+	switch r.settings.Visibility {
+	case VisibilityPrivate:
+		return secretEqual(key, r.settings.Password)
+	case VisibilityInvite:
+		return secretEqual(key, r.invite)
+	}
+	return true
+}
+
+// secretEqual compares a secret a client gave with the real one in constant
+// time.
+func secretEqual(given, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(secret)) == 1
+}
+
+// emitJoined tells client c, player id, that they are in the room. The owner
+// of an invite room is given its invite code to hand out.
+func (r *Room) emitJoined(c *Client, id, reply string) {
+	response := JoinRoomResponse{Room: r.name}
+	if id == r.settings.owner {
+		response.Invite = r.invite
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Failed to marshal join room response: %v", err)
+		return
+	}
+	emit(Event{Type: EventJoinRoom, Payload: data, ID: reply}, c)
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPrivateRoomNeedsPassword(t *testing.T) {
+	h := NewHub()
+	owner, ro := newTestClient(h, "p1")
+	guest, rg := newTestClient(h, "p2")
+
+	send(t, owner, EventJoinRoom, JoinRoomEvent{Room: "scrim", Settings: &RoomSettings{Visibility: VisibilityPrivate}})
+	expectError(t, ro, CodeInvalidSettings, EventJoinRoom)
+	send(t, owner, EventJoinRoom, JoinRoomEvent{Room: "open", Settings: &RoomSettings{Password: "hunter2"}})
+	expectError(t, ro, CodeInvalidSettings, EventJoinRoom)
+
+	if err := send(t, owner, EventJoinRoom, JoinRoomEvent{Room: "scrim", Settings: &RoomSettings{Visibility: VisibilityPrivate, Password: "hunter2"}}); err != nil {
+		t.Fatalf("Failed to create private room: %v", err)
+	}
+	if rooms := h.roomList(); len(rooms) != 0 {
+		t.Errorf("Expected the private room to be left out of the room list, got %+v", rooms)
+	}
+
+	send(t, guest, EventJoinRoom, JoinRoomEvent{Room: "scrim"})
+	expectError(t, rg, CodeNotInvited, EventJoinRoom)
+	send(t, guest, EventJoinRoom, JoinRoomEvent{Room: "scrim", Password: "hunter3"})
+	expectError(t, rg, CodeNotInvited, EventJoinRoom)
+	if guest.room != "" {
+		t.Errorf("Expected a rejected client back in the lobby, got room %q", guest.room)
+	}
+
+	if err := send(t, guest, EventJoinRoom, JoinRoomEvent{Room: "scrim", Password: "hunter2"}); err != nil {
+		t.Fatalf("Failed to join with the password: %v", err)
+	}
+	waitForState(t, rg, func(gs GameState) bool { return len(gs.PlayerStates) == 2 })
+}
+
+func TestJoinIgnoresSettingsOfExistingRoom(t *testing.T) {
+	h := NewHub()
+	owner, _ := newTestClient(h, "p1")
+	guest, rg := newTestClient(h, "p2")
+	if err := send(t, owner, EventJoinRoom, JoinRoomEvent{Room: "scrim", Settings: &RoomSettings{Visibility: VisibilityPrivate, Password: "hunter2"}}); err != nil {
+		t.Fatalf("Failed to create private room: %v", err)
+	}
+
+	// Settings that could not create a room are no reason to turn a join away
+	join := JoinRoomEvent{Room: "scrim", Password: "hunter2", Settings: &RoomSettings{Visibility: VisibilityPrivate, BestOf: 4}}
+	if err := send(t, guest, EventJoinRoom, join); err != nil {
+		t.Fatalf("Failed to join with settings of its own: %v", err)
+	}
+	gs := waitForState(t, rg, func(gs GameState) bool { return len(gs.PlayerStates) == 2 })
+	if gs.Series != nil {
+		t.Errorf("Expected the room's own single game, got %+v", gs.Series)
+	}
+	if rooms := h.roomList(); len(rooms) != 0 {
+		t.Errorf("Expected the room to stay private, got %+v", rooms)
+	}
+}
+
+func TestInviteRoomNeedsCode(t *testing.T) {
+	h := NewHub()
+	owner, ro := newTestClient(h, "p1")
+	guest, rg := newTestClient(h, "p2")
+
+	send(t, owner, EventJoinRoom, JoinRoomEvent{Room: "scrim", Settings: &RoomSettings{Visibility: VisibilityInvite}})
+	var joined JoinRoomResponse
+	if err := json.Unmarshal(waitFor(t, ro, EventJoinRoom).Payload, &joined); err != nil {
+		t.Fatalf("Failed to unmarshal join room response: %v", err)
+	}
+	if joined.Invite == "" {
+		t.Fatalf("Expected the owner to be given an invite code")
+	}
+	if rooms := h.roomList(); len(rooms) != 0 {
+		t.Errorf("Expected the invite room to be left out of the room list, got %+v", rooms)
+	}
+
+	send(t, guest, EventJoinRoom, JoinRoomEvent{Room: "scrim", Spectate: true})
+	expectError(t, rg, CodeNotInvited, EventJoinRoom)
+
+	if err := send(t, guest, EventJoinRoom, JoinRoomEvent{Room: "scrim", Invite: joined.Invite}); err != nil {
+		t.Fatalf("Failed to join with the invite code: %v", err)
+	}
+	var guestJoined JoinRoomResponse
+	if err := json.Unmarshal(waitFor(t, rg, EventJoinRoom).Payload, &guestJoined); err != nil {
+		t.Fatalf("Failed to unmarshal join room response: %v", err)
+	}
+	if guestJoined.Invite != "" {
+		t.Errorf("Expected only the owner to be given the invite code")
+	}
+	waitForState(t, rg, func(gs GameState) bool { return len(gs.PlayerStates) == 2 })
+}
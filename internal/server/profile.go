@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"prisoner-fencing/internal/database"
+)
+
+// Avatars a player can pick from. The frontend has an image for each.
+var Avatars = []string{"fencer", "prisoner", "guard", "knight", "rogue", "duelist"}
+
+// validDisplayName is what a display name may look like.
+var validDisplayName = regexp.MustCompile(`^[A-Za-z0-9_-]{3,20}$`)
+
+// ProfileRequest is the body of a registration or profile update.
+type ProfileRequest struct {
+	DisplayName string `json:"displayName"`
+	Avatar      string `json:"avatar"`
+}
+
+// validate checks a requested profile.
+func (p ProfileRequest) validate() error {
+	if !validDisplayName.MatchString(p.DisplayName) {
+		return fmt.Errorf("display name must be 3 to 20 letters, digits, _ or -")
+	}
+	if !slices.Contains(Avatars, p.Avatar) {
+		return fmt.Errorf("avatar must be one of %s", strings.Join(Avatars, ", "))
+	}
+	return nil
+}
+
+// displayName returns the name to show for player id: their display name if
+// they registered one, and their id otherwise. Names are cached, since chat
+// and game events need them all the time.
+func (h *Hub) displayName(id string) string {
+	h.RLock()
+	name, cached := h.names[id]
+	h.RUnlock()
+	if cached {
+		return name
+	}
+
+	name = id
+	if h.db != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		p, err := h.db.GetPlayer(ctx, id)
+		switch {
+		case err == nil:
+			name = p.DisplayName
+		case !errors.Is(err, database.ErrNotFound):
+			log.Printf("Failed to get player %s: %v", id, err)
+			return id // Try again next time
+		}
+	}
+	h.setDisplayName(id, name)
+	return name
+}
+
+// setDisplayName records the display name of player id.
+func (h *Hub) setDisplayName(id, name string) {
+	h.Lock()
+	defer h.Unlock()
+	h.names[id] = name
+}
+
+// setId records who c is. The client's own goroutine may read its id freely,
+// any other must hold the lock.
+func (h *Hub) setId(c *Client, id string) {
+	h.Lock()
+	defer h.Unlock()
+	c.id = id
+}
+
+// forgetDisplayName drops the cached name of player id once they have no
+// connection left. The caller must hold the lock.
+func (h *Hub) forgetDisplayName(id string) {
+	for client := range h.client {
+		if client.id == id {
+			return
+		}
+	}
+	delete(h.names, id)
+}
+
+// sessionPlayer returns the player id from the request's bearer token.
+func (s *Server) sessionPlayer(r *http.Request) (string, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", errInvalidToken
+	}
+	return s.sessions.verify(token, time.Now())
+}
+
+// registerHandler gives the session's player a profile, turning a guest into
+// a registered player.
+func (s *Server) registerHandler(w http.ResponseWriter, r *http.Request) {
+	s.saveProfile(w, r, true)
+}
+
+// updateProfileHandler changes the session's player's profile.
+func (s *Server) updateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	s.saveProfile(w, r, false)
+}
+
+func (s *Server) saveProfile(w http.ResponseWriter, r *http.Request, create bool) {
+	id, err := s.sessionPlayer(r)
+	if err != nil {
+		http.Error(w, "Invalid session", http.StatusUnauthorized)
+		return
+	}
+	var req ProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid profile", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p := database.Player{Id: id, DisplayName: req.DisplayName, Avatar: req.Avatar, CreatedAt: time.Now()}
+	if create {
+		if _, err := s.db.GetPlayer(r.Context(), id); err == nil {
+			http.Error(w, "Player is already registered", http.StatusConflict)
+			return
+		}
+		err = s.db.CreatePlayer(r.Context(), p)
+	} else {
+		err = s.db.UpdatePlayer(r.Context(), p)
+	}
+	switch {
+	case errors.Is(err, database.ErrNameTaken):
+		http.Error(w, "Display name is taken", http.StatusConflict)
+		return
+	case errors.Is(err, database.ErrNotFound):
+		http.Error(w, "Player is not registered", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("Failed to save player: %v", err)
+		http.Error(w, "Failed to save player", http.StatusInternalServerError)
+		return
+	}
+	s.hub.setDisplayName(id, p.DisplayName)
+
+	if p, err = s.db.GetPlayer(r.Context(), id); err != nil {
+		log.Printf("Failed to get player: %v", err)
+		http.Error(w, "Failed to get player", http.StatusInternalServerError)
+		return
+	}
+	if create {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(p); err != nil {
+			log.Printf("Failed to write response: %v", err)
+		}
+		return
+	}
+	writeJSON(w, p)
+}
+
+func (s *Server) profileHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := s.db.GetPlayer(r.Context(), r.PathValue("id"))
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "Player not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get player: %v", err)
+		http.Error(w, "Failed to get player", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, p)
+}
+
+func (s *Server) avatarsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, Avatars)
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"prisoner-fencing/internal/database"
+)
+
+func TestProfiles(t *testing.T) {
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	s := &Server{db: db, sessions: newSessions("secret")}
+	server := httptest.NewServer(s.RegisterRoutes())
+	defer server.Close()
+
+	request := func(method, path, token, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	p1 := s.sessions.issue("guest-1", time.Now())
+	p2 := s.sessions.issue("guest-2", time.Now())
+
+	tests := []struct {
+		method, path, token, body string
+		status                    int
+	}{
+		{"POST", "/players", "", `{"displayName": "Zorro", "avatar": "fencer"}`, http.StatusUnauthorized},
+		{"POST", "/players", p1, `{"displayName": "Zorro", "avatar": "unicorn"}`, http.StatusBadRequest},
+		{"POST", "/players", p1, `{"displayName": "Z", "avatar": "fencer"}`, http.StatusBadRequest},
+		{"PUT", "/players/me", p1, `{"displayName": "Zorro", "avatar": "fencer"}`, http.StatusNotFound},
+		{"POST", "/players", p1, `{"displayName": "Zorro", "avatar": "fencer"}`, http.StatusCreated},
+		{"POST", "/players", p1, `{"displayName": "Zorro2", "avatar": "fencer"}`, http.StatusConflict},
+		{"POST", "/players", p2, `{"displayName": "zorro", "avatar": "rogue"}`, http.StatusConflict},
+		{"PUT", "/players/me", p1, `{"displayName": "El_Zorro", "avatar": "knight"}`, http.StatusOK},
+		{"GET", "/players/guest-1", "", "", http.StatusOK},
+		{"GET", "/players/guest-2", "", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if resp := request(tt.method, tt.path, tt.token, tt.body); resp.StatusCode != tt.status {
+			t.Errorf("%s %s: expected status %d; got %v", tt.method, tt.path, tt.status, resp.Status)
+		}
+	}
+
+	// The server puts the display name on chat, whatever the client claims
+	c, received := newTestClient(s.hub, "guest-1")
+	send(t, c, EventSendMessage, SendMessageEvent{Message: "En garde!", From: "guest-2"})
+	var msg NewMessageEvent
+	if err := json.Unmarshal(waitFor(t, received, EventNewMessage).Payload, &msg); err != nil {
+		t.Fatalf("failed to unmarshal message: %v", err)
+	}
+	if msg.From != "guest-1" || msg.Name != "El_Zorro" {
+		t.Errorf("expected the message from El_Zorro; got %+v", msg)
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"prisoner-fencing/internal/database"
+	"prisoner-fencing/internal/engine"
+)
+
+// replayVersion is bumped whenever the replay format changes in a way old
+// readers would misunderstand.
+const replayVersion = 1
+
+// Replay is a finished match as a timeline a client can step through. The
+// first entry of Turns leads from Start to the state after turn 1, and so on.
+type Replay struct {
+	Version int              `json:"version"`
+	MatchId int64            `json:"matchId"`
+	Rules   engine.Ruleset   `json:"rules"`
+	Players [2]string        `json:"players"` // ids of player 1 and player 2
+	Start   [2]engine.Player `json:"start"`
+	Turns   []ReplayTurn     `json:"turns"`
+	Winner  int              `json:"winner"` // 1 or 2, 0 for a draw
+	Reason  string           `json:"reason"`
+}
+
+// ReplayTurn is one step of a Replay.
+type ReplayTurn struct {
+	Turn     int              `json:"turn"`
+	Actions  [2]engine.Action `json:"actions"`
+	Before   [2]engine.Player `json:"before"`
+	After    [2]engine.Player `json:"after"`
+	Outcomes []engine.Outcome `json:"outcomes"`
+	Log      string           `json:"log"`
+	// Commitments and Nonces are set for a commit-reveal game, so anyone can
+	// check each action against the commitment made before it was revealed.
+	Commitments []string `json:"commitments,omitempty"`
+	Nonces      []string `json:"nonces,omitempty"`
+}
+
+// newReplay builds the replay of a stored match.
+func newReplay(m database.Match) Replay {
+	replay := Replay{
+		Version: replayVersion,
+		MatchId: m.ID,
+		Rules:   m.Rules,
+		Start:   engine.NewState(m.Rules).Players,
+		Turns:   make([]ReplayTurn, 0, len(m.Turns)),
+		Winner:  m.Winner,
+		Reason:  m.Reason,
+	}
+	for _, p := range m.Participants {
+		if p.Seat == 1 || p.Seat == 2 {
+			replay.Players[p.Seat-1] = p.PlayerId
+		}
+	}
+	for _, t := range m.Turns {
+		rt := ReplayTurn{Turn: t.Turn, Actions: t.Actions, Outcomes: t.Outcomes, Log: t.Log}
+		for i, p := range t.Players {
+			rt.Before[i], rt.After[i] = p.Before, p.After
+		}
+		if t.Players[0].Commitment != "" || t.Players[1].Commitment != "" {
+			rt.Commitments = []string{t.Players[0].Commitment, t.Players[1].Commitment}
+			rt.Nonces = []string{t.Players[0].Nonce, t.Players[1].Nonce}
+		}
+		if rt.Outcomes == nil {
+			rt.Outcomes = []engine.Outcome{}
+		}
+		replay.Turns = append(replay.Turns, rt)
+	}
+	// Matches stored before their rules were recorded still have the
+	// starting squares in their first turn
+	if len(m.Turns) > 0 {
+		replay.Start = replay.Turns[0].Before
+	}
+	return replay
+}
+
+func (s *Server) replayHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid match id", http.StatusBadRequest)
+		return
+	}
+	match, err := s.db.GetMatch(r.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "Match not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get match: %v", err)
+		http.Error(w, "Failed to get match", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, newReplay(match))
+}
@@ -0,0 +1,759 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"prisoner-fencing/internal/bot"
+	"prisoner-fencing/internal/database"
+	"prisoner-fencing/internal/engine"
+)
+
+var errRoomClosed = &HandlerError{Code: CodeRoomNotFound, Message: "room closed"}
+
+type commandKind int
+
+const (
+	commandJoin commandKind = iota
+	commandLeave
+	commandAction
+	commandCommit
+	commandReveal
+	commandChat
+	commandDisconnect
+	commandReconnect
+	commandTick
+	commandRematch
+)
+
+// roomCommand is a request for a Room to do something. Every change to a
+// room's game state goes through its command channel.
+type roomCommand struct {
+	kind   commandKind
+	client *Client
+	id     string        // player id of client when the command was sent
+	action engine.Action // for commandAction and commandReveal
+	// secret is the commitment for commandCommit, the nonce for
+	// commandReveal, and the password or invite code for commandJoin
+	secret string
+	name   string // display name of the player, for commandJoin
+	// spectate joins as a spectator even if a seat is free, for commandJoin
+	spectate bool
+	event    Event  // for commandChat
+	reply    string // id of the client's event, echoed on the room's direct reply
+	result   chan error
+}
+
+// TurnTimer configures the per-turn action deadline of a room.
+type TurnTimer struct {
+	Seconds int           `json:"seconds"`           // time to choose an action, 0 disables the timer
+	Action  engine.Action `json:"action,omitempty"`  // played for a player who runs out of time, WAIT by default
+	Penalty int           `json:"penalty,omitempty"` // energy taken from a player who runs out of time
+}
+
+// RoomSettings are chosen by the client that creates a room.
+type RoomSettings struct {
+	Timer TurnTimer `json:"timer"`
+	// CommitReveal makes players send a hash commitment of their action
+	// before revealing it, so neither the opponent nor the server can peek.
+	CommitReveal bool `json:"commitReveal"`
+	// TieBreak is the policy for a square both players advance into, see
+	// the TieBreak constants. Seed seeds the coin flip policy.
+	TieBreak string `json:"tieBreak"`
+	Seed     int64  `json:"seed,omitempty"`
+	// Ruleset is the name of the rules the room plays by, the standard
+	// ones by default.
+	Ruleset string `json:"ruleset,omitempty"`
+	// Bot fills the second seat with a server side player of this strength,
+	// see the bot package. Empty waits for a human.
+	Bot string `json:"bot,omitempty"`
+	// Casual games leave the players' ratings alone. Games against a bot
+	// are always casual.
+	Casual bool `json:"casual,omitempty"`
+	// SpectatorDelay holds the game back from spectators by this many
+	// turns, so they cannot relay what they see to a player.
+	SpectatorDelay int `json:"spectatorDelay,omitempty"`
+	// Visibility says who may find and join the room, see the Visibility
+	// constants. Public by default.
+	Visibility string `json:"visibility,omitempty"`
+	// Password must be given to join a private room.
+	Password string `json:"password,omitempty"`
+	// BestOf plays games in series of this many, 1 by default. The winner
+	// of most of them wins the series.
+	BestOf int `json:"bestOf,omitempty"`
+
+	rules        engine.Ruleset // looked up from Ruleset by normalize
+	players      [2]string      // ids of the matched players the seats are kept for, see reserved
+	owner        string         // player id of whoever created the room
+	ownerName    string         // display name of the owner
+	tournamentId string         // id of the tournament the room plays a match of, see reportTournament
+	pairing      int            // id of that match in the tournament's bracket
+	replayDraws  bool           // the match is played again if drawn, as elimination matches are
+	joinBy       time.Time      // when a tournament match's absent players forfeit, see forfeitNoShow
+}
+
+// Room is a game room. All of its state is owned by the goroutine started in
+// newRoom, which handles one command at a time.
+type Room struct {
+	name     string
+	hub      *Hub
+	settings RoomSettings
+	commands chan roomCommand
+	done     chan struct{}
+	created  time.Time
+	invite   string // code that must be given to join an invite room
+
+	// The room's entry in the room list, see publish
+	listingMu sync.Mutex
+	listing   RoomInfo
+
+	// Owned by the run goroutine
+	clients      map[*Client]string   // client -> player id
+	spectators   map[*Client]bool     // clients who joined to watch, see spectating
+	feed         []GameState          // spectator views held back by the spectator delay
+	released     *GameState           // latest spectator view let out of the feed
+	disconnected map[string]time.Time // player id -> end of their reconnect grace period
+	state        *GameState
+	gameOver     bool      // the last game ended and no new one has started
+	series       *series   // series the players of the last game are playing
+	last         [2]string // ids of player 1 and player 2 of the last game
+	lastNames    [2]string
+	wantRematch  map[string]bool // players of the last game who asked for a rematch
+	calledOff    bool            // the matched players did not both turn up, see callOffMatch
+	closed       bool            // closed for being idle, see closeIfIdle
+	active       time.Time       // when a client last sent the room a command
+	idleTimer    *time.Timer
+	turnDeadline time.Time // zero while no turn timer is running
+	turnTimer    *time.Timer
+	rng          *rand.Rand // coin for the coin flip tie-break
+}
+
+// normalize checks the settings against the hub and fills in defaults.
+func (s *RoomSettings) normalize(h *Hub) error {
+	if s.Timer.Action == "" {
+		s.Timer.Action = engine.ActionWait
+	}
+	if !s.Timer.Action.Valid() {
+		return fmt.Errorf("unknown timeout action: %s", s.Timer.Action)
+	}
+	policy, err := validTieBreak(s.TieBreak)
+	if err != nil {
+		return err
+	}
+	s.TieBreak = policy
+	if s.rules, err = h.ruleset(s.Ruleset); err != nil {
+		return err
+	}
+	s.Ruleset = s.rules.Name
+	if s.Bot != "" && !bot.Valid(s.Bot) {
+		return fmt.Errorf("unknown bot strength: %s", s.Bot)
+	}
+	if s.SpectatorDelay < 0 {
+		return fmt.Errorf("spectator delay cannot be negative")
+	}
+	switch s.Visibility {
+	case "":
+		s.Visibility = VisibilityPublic
+	case VisibilityPublic, VisibilityPrivate, VisibilityInvite:
+	default:
+		return fmt.Errorf("unknown visibility: %s", s.Visibility)
+	}
+	switch s.BestOf {
+	case 0:
+		s.BestOf = 1
+	case 1, 3, 5:
+	default:
+		return fmt.Errorf("series must be best of 1, 3 or 5 games")
+	}
+	if s.Visibility == VisibilityPrivate && s.Password == "" && s.players[0] == "" {
+		return fmt.Errorf("a private room needs a password")
+	}
+	if s.Visibility != VisibilityPrivate && s.Password != "" {
+		return fmt.Errorf("only private rooms have a password")
+	}
+	return nil
+}
+
+// newRoom starts a room. The settings must have been normalized.
+func newRoom(name string, hub *Hub, settings RoomSettings) *Room {
+	r := &Room{
+		name:         name,
+		hub:          hub,
+		settings:     settings,
+		commands:     make(chan roomCommand),
+		done:         make(chan struct{}),
+		created:      time.Now(),
+		clients:      make(map[*Client]string),
+		spectators:   make(map[*Client]bool),
+		disconnected: make(map[string]time.Time),
+		wantRematch:  make(map[string]bool),
+		rng:          newTieBreakRand(settings.Seed),
+	}
+	if settings.Visibility == VisibilityInvite {
+		r.invite = randomHex(8)
+	}
+	r.active = r.created
+	r.listing = r.describe()
+	if hub.idleTimeout > 0 {
+		r.idleTimer = time.AfterFunc(hub.idleTimeout, func() {
+			r.send(roomCommand{kind: commandTick})
+		})
+	}
+	go r.run()
+	if r.reserved() {
+		time.AfterFunc(matchJoinTimeout, func() {
+			r.send(roomCommand{kind: commandTick})
+		})
+	}
+	return r
+}
+
+// send hands a command to the room goroutine and waits for it to be handled.
+func (r *Room) send(cmd roomCommand) error {
+	cmd.result = make(chan error, 1)
+	select {
+	case r.commands <- cmd:
+	case <-r.done:
+		return errRoomClosed
+	}
+	return <-cmd.result
+}
+
+func (r *Room) run() {
+	for cmd := range r.commands {
+		var err error
+		switch cmd.kind {
+		case commandJoin:
+			err = r.join(cmd.client, cmd.id, cmd.name, cmd.secret, cmd.reply, cmd.spectate)
+		case commandLeave:
+			r.leave(cmd.client, cmd.reply)
+		case commandAction:
+			err = r.act(cmd.client, cmd.id, cmd.action)
+		case commandCommit:
+			err = r.commit(cmd.client, cmd.id, cmd.secret)
+		case commandReveal:
+			err = r.reveal(cmd.client, cmd.id, cmd.action, cmd.secret)
+		case commandChat:
+			r.emit(cmd.event)
+		case commandDisconnect:
+			r.disconnect(cmd.client)
+		case commandReconnect:
+			err = r.reconnect(cmd.client, cmd.id)
+		case commandTick:
+			r.tick(time.Now())
+		case commandRematch:
+			err = r.rematch(cmd.client, cmd.id)
+		}
+		if cmd.kind != commandTick {
+			r.active = time.Now()
+		}
+		// Keep the room while a disconnected or matched player may still
+		// come back
+		if r.closed || len(r.clients) == 0 && len(r.disconnected) == 0 && !r.awaitingMatch() {
+			if r.idleTimer != nil {
+				r.idleTimer.Stop()
+			}
+			r.hub.deleteRoom(r)
+			close(r.done)
+			cmd.result <- err
+			r.hub.emitRoomList()
+			return
+		}
+		r.publish()
+		cmd.result <- err
+	}
+}
+
+// emit sends an event to every client in the room.
+func (r *Room) emit(event Event) {
+	for client := range r.clients {
+		emit(event, client)
+	}
+}
+
+// join puts client c, player id, in the room. key is the password or invite
+// code they gave, and a non-empty reply is the id of the join_room event
+// asking.
+func (r *Room) join(c *Client, id, name, key, reply string, spectate bool) error {
+	// A bot only ever takes the seat opposite a waiting player
+	if c.bot && (r.state == nil || len(r.state.PlayerStates) != 1) {
+		return handlerError(CodeNoSeat, "no player waiting for a bot in room: %s", r.name)
+	}
+	if r.reserved() && id != r.settings.players[0] && id != r.settings.players[1] {
+		return handlerError(CodeNoSeat, "room %s is kept for a matched game", r.name)
+	}
+	if !r.admits(c, id, key) {
+		return handlerError(CodeNotInvited, "room %s needs a valid password or invite code", r.name)
+	}
+	r.clients[c] = id
+	r.emitJoined(c, id, reply)
+
+	// Between the games of a series only its players may start the next one,
+	// with rematch, and anyone else waits to watch it
+	if r.seriesPending() {
+		status := `{"status": "Waiting for the players to start their next game"}`
+		if id == r.last[0] || id == r.last[1] {
+			status = `{"status": "Waiting for a rematch"}`
+		}
+		emit(Event{Type: "UPDATE_STATUS", Payload: json.RawMessage(status)}, c)
+		return nil
+	}
+
+	// Initialize GameState for the room if it doesn't exist
+	if r.state == nil {
+		r.state = newGameState(r.settings.rules)
+		r.gameOver = false
+	}
+	gs := r.state
+
+	_, seated := gs.PlayerStates[id]
+	if spectate || (!seated && len(gs.PlayerStates) >= 2) {
+		if spectate {
+			r.spectators[c] = true
+		}
+		r.welcomeSpectator(c)
+		r.emitSpectatorCount()
+		return nil
+	}
+	if seated {
+		// A player back in their seat from another connection
+		emitGameState(r.view(id, false), c)
+		return nil
+	}
+	gs.seat(id, name)
+	if ids, full := gs.seats(); full {
+		r.beginGame(ids)
+	} else if r.settings.Bot != "" && !c.bot {
+		go r.hub.addBot(r.name, r.settings.Bot)
+	}
+
+	r.broadcast(engine.Result{}, "", false)
+	return nil
+}
+
+// leave removes a client from the room. A seated player who leaves a game in
+// progress forfeits it; one who leaves while waiting for an opponent gives up
+// their seat. A non-empty reply is the id of the leave_room event asking.
+func (r *Room) leave(c *Client, reply string) {
+	id, ok := r.clients[c]
+	if !ok {
+		return
+	}
+	spectator := r.spectating(c, id)
+	delete(r.clients, c)
+	delete(r.spectators, c)
+	r.abandonSeries(id)
+
+	emit(Event{
+		Type:    EventLeaveRoom,
+		Payload: json.RawMessage(fmt.Sprintf(`{"room": "%s"}`, r.name)),
+		ID:      reply,
+	}, c)
+	if spectator {
+		r.emitSpectatorCount()
+		return
+	}
+
+	gs := r.state
+	if gs == nil {
+		return
+	}
+	ps, seated := gs.PlayerStates[id]
+	if !seated {
+		return
+	}
+	if _, full := gs.seats(); !full {
+		delete(gs.PlayerStates, id)
+		gs.Status = "Waiting for opponent to arrive"
+		r.broadcast(engine.Result{}, "", false)
+		return
+	}
+
+	r.endGame(engine.Forfeit(ps.Player), ReasonForfeit)
+}
+
+// disconnect handles a client whose connection dropped. A seated player in a
+// game in progress gets the hub's reconnect grace period to come back before
+// the game is forfeited; anyone else simply leaves.
+func (r *Room) disconnect(c *Client) {
+	id, ok := r.clients[c]
+	if !ok {
+		return
+	}
+	gs := r.state
+	if gs == nil || r.spectating(c, id) {
+		r.leave(c, "")
+		return
+	}
+	_, seated := gs.PlayerStates[id]
+	if _, full := gs.seats(); !seated || !full || r.hub.reconnectGrace <= 0 {
+		r.leave(c, "")
+		return
+	}
+	delete(r.clients, c)
+
+	r.disconnected[id] = time.Now().Add(r.hub.reconnectGrace)
+	r.hub.setAwaitingReconnect(id, r.name)
+	time.AfterFunc(r.hub.reconnectGrace, func() {
+		r.send(roomCommand{kind: commandTick})
+	})
+
+	r.emit(Event{
+		Type:    "UPDATE_STATUS",
+		Payload: json.RawMessage(`{"status": "Opponent disconnected, waiting for them to reconnect"}`),
+	})
+}
+
+// reconnect puts a player who dropped back into their seat.
+func (r *Room) reconnect(c *Client, id string) error {
+	if _, ok := r.disconnected[id]; !ok {
+		return handlerError(CodeNoSeat, "no seat to reconnect to in room: %s", r.name)
+	}
+	delete(r.disconnected, id)
+	r.hub.setAwaitingReconnect(id, "")
+	r.clients[c] = id
+	r.emitJoined(c, id, "")
+
+	data, err := json.Marshal(r.view(id, false))
+	if err != nil {
+		return fmt.Errorf("failed to marshal reconnect response: %v", err)
+	}
+	emit(Event{
+		Type:    "GAME_ACTION_RESULT",
+		Payload: data,
+	}, c)
+
+	for client := range r.clients {
+		if client != c {
+			emit(Event{
+				Type:    "UPDATE_STATUS",
+				Payload: json.RawMessage(`{"status": "Opponent reconnected"}`),
+			}, client)
+		}
+	}
+	return nil
+}
+
+// tick handles everything in the room that depends on the clock.
+func (r *Room) tick(now time.Time) {
+	r.callOffMatch(now)
+	r.forfeitNoShow(now)
+	r.closeIfIdle(now)
+
+	for id, deadline := range r.disconnected {
+		if now.Before(deadline) {
+			continue
+		}
+		delete(r.disconnected, id)
+		r.hub.setAwaitingReconnect(id, "")
+		if r.state == nil {
+			continue
+		}
+		if ps, ok := r.state.PlayerStates[id]; ok {
+			r.endGame(engine.Forfeit(ps.Player), ReasonDisconnect)
+		}
+	}
+
+	if !r.turnDeadline.IsZero() && !now.Before(r.turnDeadline) && r.state != nil {
+		r.timeOutTurn()
+	}
+}
+
+// startTurnTimer gives both players the room's turn time to choose an action.
+func (r *Room) startTurnTimer() {
+	r.stopTurnTimer()
+	if r.settings.Timer.Seconds <= 0 {
+		return
+	}
+	d := time.Duration(r.settings.Timer.Seconds) * time.Second
+	r.turnDeadline = time.Now().Add(d)
+	r.turnTimer = time.AfterFunc(d, func() {
+		r.send(roomCommand{kind: commandTick})
+	})
+}
+
+func (r *Room) stopTurnTimer() {
+	if r.turnTimer != nil {
+		r.turnTimer.Stop()
+		r.turnTimer = nil
+	}
+	r.turnDeadline = time.Time{}
+}
+
+// timeOutTurn plays the timeout action, and takes the timeout penalty, for
+// every player who has not acted in time, then resolves the turn.
+func (r *Room) timeOutTurn() {
+	gs := r.state
+	ids, ok := gs.seats()
+	if !ok {
+		return
+	}
+	var timedOut []string
+	for _, id := range ids {
+		ps := gs.PlayerStates[id]
+		if ps.Action != "" {
+			continue
+		}
+		ps.Action = r.settings.Timer.Action
+		ps.submittedAt = time.Now()
+		gs.PlayerStates[id] = ps
+		timedOut = append(timedOut, id)
+	}
+	r.resolveTurn(ids, timedOut)
+}
+
+// player returns the state of client c, player id, in the game in progress,
+// or an error if there is no such game or they are not seated in it.
+func (r *Room) player(c *Client, id string) (PlayerState, error) {
+	if r.spectators[c] {
+		return PlayerState{}, handlerError(CodeNotSeated, "spectators cannot play in room: %s", r.name)
+	}
+	if r.state == nil {
+		if r.gameOver {
+			return PlayerState{}, handlerError(CodeGameOver, "game in room %s is over", r.name)
+		}
+		return PlayerState{}, handlerError(CodeWrongPhase, "no game in progress in room: %s", r.name)
+	}
+	ps, ok := r.state.PlayerStates[id]
+	if !ok {
+		return PlayerState{}, handlerError(CodeNotSeated, "player is not seated in room: %s", r.name)
+	}
+	return ps, nil
+}
+
+func (r *Room) act(c *Client, id string, action engine.Action) error {
+	ps, err := r.player(c, id)
+	if err != nil {
+		return err
+	}
+	if r.settings.CommitReveal {
+		return handlerError(CodeWrongPhase, "room %s uses commit-reveal, send %s instead", r.name, EventGameCommit)
+	}
+	if ps.Action != "" {
+		return handlerError(CodeAlreadySubmitted, "already acted this turn")
+	}
+	ps.Action = action
+	ps.submittedAt = time.Now()
+	r.state.PlayerStates[id] = ps
+
+	r.resolveIfReady(c)
+	return nil
+}
+
+// commit records a player's commitment to an action in a commit-reveal room.
+// Once both players have committed they are asked to reveal.
+func (r *Room) commit(c *Client, id, commitment string) error {
+	ps, err := r.player(c, id)
+	if err != nil {
+		return err
+	}
+	if !r.settings.CommitReveal {
+		return handlerError(CodeWrongPhase, "room %s does not use commit-reveal", r.name)
+	}
+	if !engine.ValidCommitment(commitment) {
+		return handlerError(CodeInvalidPayload, "commitment must be a SHA-256 digest in lowercase hex")
+	}
+	gs := r.state
+	if ps.Commitment != "" {
+		return handlerError(CodeAlreadySubmitted, "already committed this turn")
+	}
+	ps.Commitment = commitment
+	ps.submittedAt = time.Now()
+	gs.PlayerStates[id] = ps
+
+	ids, ok := gs.seats()
+	if !ok || gs.PlayerStates[ids[0]].Commitment == "" || gs.PlayerStates[ids[1]].Commitment == "" {
+		emit(Event{
+			Type:    "UPDATE_STATUS",
+			Payload: json.RawMessage(`{"status": "Waiting for opponent to commit"}`),
+		}, c)
+		return nil
+	}
+
+	for client, clientId := range r.clients {
+		if clientId == ids[0] || clientId == ids[1] {
+			emit(Event{
+				Type:    "REVEAL_ACTIONS",
+				Payload: json.RawMessage(`{"status": "Both players committed, reveal your action"}`),
+			}, client)
+		}
+	}
+	return nil
+}
+
+// reveal checks a revealed action against the player's commitment and
+// resolves the turn once both actions are revealed.
+func (r *Room) reveal(c *Client, id string, action engine.Action, nonce string) error {
+	ps, err := r.player(c, id)
+	if err != nil {
+		return err
+	}
+	gs := r.state
+	ids, ok := gs.seats()
+	if !ok || gs.PlayerStates[ids[0]].Commitment == "" || gs.PlayerStates[ids[1]].Commitment == "" {
+		return handlerError(CodeWrongPhase, "cannot reveal before both players have committed")
+	}
+	if ps.Action != "" {
+		return handlerError(CodeAlreadySubmitted, "already revealed this turn")
+	}
+	if !engine.VerifyReveal(ps.Commitment, action, nonce) {
+		return handlerError(CodeCommitmentMismatch, "revealed action does not match commitment")
+	}
+	ps.Action = action
+	ps.Nonce = nonce
+	gs.PlayerStates[id] = ps
+
+	r.resolveIfReady(c)
+	return nil
+}
+
+// resolveIfReady resolves the turn if both seated players have an action, and
+// otherwise tells c what the room is waiting for.
+func (r *Room) resolveIfReady(c *Client) {
+	gs := r.state
+	ids, ok := gs.seats()
+	if !ok {
+		emit(Event{
+			Type:    "UPDATE_STATUS",
+			Payload: json.RawMessage(`{"status": "Waiting for opponent to arrive"}`),
+		}, c)
+		return
+	}
+
+	// Check if both players have made their actions
+	if gs.PlayerStates[ids[0]].Action == "" || gs.PlayerStates[ids[1]].Action == "" {
+		emit(Event{
+			Type:    "UPDATE_STATUS",
+			Payload: json.RawMessage(`{"status": "Waiting for opponent to act"}`),
+		}, c)
+		return
+	}
+
+	r.resolveTurn(ids, nil)
+}
+
+// resolveTurn plays the turn once both seated players have an action and
+// sends everyone the outcome. The players timedOut take the timeout penalty
+// as part of the turn.
+func (r *Room) resolveTurn(ids [2]string, timedOut []string) {
+	gs := r.state
+	// Taken before the penalty, so the recorded turn starts from the state
+	// the players were really in
+	before := gs.engineState(ids)
+	var notes []string
+	for _, id := range timedOut {
+		ps := gs.PlayerStates[id]
+		ps.Energy -= r.settings.Timer.Penalty
+		gs.PlayerStates[id] = ps
+		notes = append(notes, fmt.Sprintf("P%d ran out of time.", ps.Player))
+	}
+	note := strings.Join(notes, " ")
+	result, outcomes := gs.resolveTurn(ids, r.priority(ids))
+	after := gs.engineState(ids)
+	for _, o := range outcomes {
+		if o.Kind == engine.OutcomeContested {
+			gs.LastAction += fmt.Sprintf(" Tie-break: %s.", tieBreakNames[r.settings.TieBreak])
+			break
+		}
+	}
+	if note != "" {
+		gs.LastAction = note + " " + gs.LastAction
+	}
+	gs.history = append(gs.history, database.Turn{
+		Turn:    gs.Turn,
+		Actions: [2]engine.Action{gs.PlayerStates[ids[0]].Action, gs.PlayerStates[ids[1]].Action},
+		Players: [2]database.TurnPlayer{
+			{Before: before.Players[0], After: after.Players[0], Commitment: gs.PlayerStates[ids[0]].Commitment, Nonce: gs.PlayerStates[ids[0]].Nonce},
+			{Before: before.Players[1], After: after.Players[1], Commitment: gs.PlayerStates[ids[1]].Commitment, Nonce: gs.PlayerStates[ids[1]].Nonce},
+		},
+		Log:      gs.LastAction,
+		Outcomes: outcomes,
+	})
+	gs.Status = "Choose an action!"
+	if result.Over {
+		r.endGame(result, resultReason(result))
+		return
+	}
+	r.startTurnTimer()
+	r.broadcast(result, "", true)
+	gs.clearActions(ids)
+}
+
+// endGame sends the final state to everyone in the room and removes the game
+// so the next join starts a fresh one.
+func (r *Room) endGame(result engine.Result, reason string) {
+	r.stopTurnTimer()
+	r.state.GameOver = true
+	r.state.Status = "Game over!"
+	// Stored first, so a client told the game is over can look the match up
+	match := r.saveMatch(result, reason)
+	if ids, full := r.state.seats(); full {
+		r.scoreGame(ids, result, reason, match)
+	}
+	r.broadcast(result, reason, true)
+	r.state = nil
+	r.gameOver = true
+
+	// Nobody can come back to a finished game
+	for id := range r.disconnected {
+		delete(r.disconnected, id)
+		r.hub.setAwaitingReconnect(id, "")
+	}
+}
+
+// view returns the game state as seen by seated player id. Unless reveal is
+// set, the action the opponent has chosen for the coming turn is hidden.
+func (r *Room) view(id string, reveal bool) GameState {
+	gs := r.state
+	ids, _ := gs.seats()
+	personalized := gs.personalize(id, ids)
+	if id == ids[0] {
+		personalized.Series = r.seriesScore(ids, [2]string{"you", "opponent"})
+	} else {
+		personalized.Series = r.seriesScore(ids, [2]string{"opponent", "you"})
+	}
+	personalized.CommitReveal = r.settings.CommitReveal
+	personalized.TieBreak = r.settings.TieBreak
+	personalized.Casual = r.settings.Casual || r.settings.Bot != ""
+	personalized.Spectators = r.spectatorCount()
+	if !reveal {
+		if opponent, ok := personalized.PlayerStates["opponent"]; ok {
+			opponent.Action, opponent.Nonce = "", "" // Prevent peek next action
+			personalized.PlayerStates["opponent"] = opponent
+		}
+	}
+	if !r.turnDeadline.IsZero() {
+		personalized.TimeLeft = time.Until(r.turnDeadline).Milliseconds()
+	}
+	return personalized
+}
+
+// broadcast sends each player in the room the game state from their point of
+// view, along with their personalized winner message, and feeds spectators
+// theirs.
+func (r *Room) broadcast(result engine.Result, reason string, reveal bool) {
+	for client, clientId := range r.clients {
+		if r.spectating(client, clientId) {
+			continue
+		}
+		personalized := r.view(clientId, reveal)
+		personalized.Winner = winnerMessage(result, reason, personalized.PlayerStates["you"].Player)
+		personalized.Reason = reason
+
+		data, err := json.Marshal(personalized)
+		if err != nil {
+			log.Printf("Failed to marshal game state: %v", err)
+			continue
+		}
+		emit(Event{
+			Type:    "GAME_ACTION_RESULT",
+			Payload: data,
+		}, client)
+	}
+	r.feedSpectators(r.spectatorView(result, reason, reveal))
+}
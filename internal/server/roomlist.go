@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// defaultIdleTimeout is how long a room nobody is playing in may go without
+// anything happening before it is closed.
+const defaultIdleTimeout = 10 * time.Minute
+
+// Who may find and join a room.
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+	VisibilityInvite  = "invite" // joined with an invite code
+)
+
+// What a room is doing.
+const (
+	RoomWaiting  = "waiting" // for players to take the seats
+	RoomPlaying  = "playing"
+	RoomFinished = "finished" // the last game is over and no new one has started
+)
+
+// RoomInfo describes a room in the room list.
+type RoomInfo struct {
+	Name       string    `json:"name"`
+	Owner      string    `json:"owner,omitempty"`     // player id of whoever created the room, empty for the server's
+	OwnerName  string    `json:"ownerName,omitempty"` // display name of the owner
+	Created    time.Time `json:"created"`
+	Ruleset    string    `json:"ruleset"`
+	BestOf     int       `json:"bestOf"` // games in a series
+	Visibility string    `json:"visibility"`
+	Seats      int       `json:"seats"`   // seats at the table
+	Players    int       `json:"players"` // seats taken
+	Spectators int       `json:"spectators"`
+	Status     string    `json:"status"`
+}
+
+// status returns what the room is doing, see the Room constants.
+func (r *Room) status() string {
+	if r.state == nil {
+		if r.gameOver {
+			return RoomFinished
+		}
+		return RoomWaiting
+	}
+	if _, full := r.state.seats(); full {
+		return RoomPlaying
+	}
+	return RoomWaiting
+}
+
+// describe returns the room's entry in the room list as it is now.
+func (r *Room) describe() RoomInfo {
+	info := RoomInfo{
+		Name:       r.name,
+		Owner:      r.settings.owner,
+		OwnerName:  r.settings.ownerName,
+		Created:    r.created,
+		Ruleset:    r.settings.Ruleset,
+		BestOf:     r.settings.BestOf,
+		Visibility: r.settings.Visibility,
+		Seats:      2,
+		Spectators: r.spectatorCount(),
+		Status:     r.status(),
+	}
+	if r.state != nil {
+		info.Players = len(r.state.PlayerStates)
+		return info
+	}
+	// Between games the players of the last one keep their seats while they
+	// are in the room
+	seated := make(map[string]bool)
+	for client, id := range r.clients {
+		if !r.spectators[client] && id != "" && (id == r.last[0] || id == r.last[1]) {
+			seated[id] = true
+		}
+	}
+	info.Players = len(seated)
+	return info
+}
+
+// publish updates the room's entry in the room list, and sends the lobby the
+// new list if it changed.
+func (r *Room) publish() {
+	info := r.describe()
+	r.listingMu.Lock()
+	changed := info != r.listing
+	r.listing = info
+	r.listingMu.Unlock()
+
+	if changed {
+		r.hub.emitRoomList()
+	}
+}
+
+// listed returns the room's entry in the room list. Unlike describe it is
+// safe to call from any goroutine.
+func (r *Room) listed() RoomInfo {
+	r.listingMu.Lock()
+	defer r.listingMu.Unlock()
+	return r.listing
+}
+
+// closeIfIdle closes the room if nothing has happened in it for the hub's
+// idle timeout, unless a game is being played. Otherwise it checks again
+// once the timeout could next run out.
+func (r *Room) closeIfIdle(now time.Time) {
+	timeout := r.hub.idleTimeout
+	if timeout <= 0 {
+		return
+	}
+	deadline := r.active.Add(timeout)
+	if r.status() == RoomPlaying {
+		r.idleTimer.Reset(timeout)
+		return
+	}
+	if now.Before(deadline) {
+		r.idleTimer.Reset(deadline.Sub(now))
+		return
+	}
+
+	r.emit(Event{
+		Type:    EventRoomClosed,
+		Payload: json.RawMessage(fmt.Sprintf(`{"room": "%s", "status": "Room closed for being idle"}`, r.name)),
+	})
+	// Everyone is back in the lobby, and sent its updates
+	for c := range r.clients {
+		r.hub.clearRoom(c, r.name)
+	}
+	clear(r.clients)
+	clear(r.spectators)
+	r.state, r.feed, r.released = nil, nil, nil
+	r.closed = true
+}
+
+// roomList returns the public rooms in order of name.
+func (h *Hub) roomList() []RoomInfo {
+	h.RLock()
+	rooms := make([]*Room, 0, len(h.rooms))
+	for _, r := range h.rooms {
+		if r.settings.listed() {
+			rooms = append(rooms, r)
+		}
+	}
+	h.RUnlock()
+
+	infos := make([]RoomInfo, len(rooms))
+	for i, r := range rooms {
+		infos[i] = r.listed()
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
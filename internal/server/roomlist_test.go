@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// waitForRooms reads room lists until one satisfies ok.
+func waitForRooms(t *testing.T, received chan Event, ok func([]RoomInfo) bool) []RoomInfo {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case event := <-received:
+			if event.Type != EventListRooms {
+				continue
+			}
+			var list ListRoomResponse
+			if err := json.Unmarshal(event.Payload, &list); err != nil {
+				t.Fatalf("failed to unmarshal room list: %v", err)
+			}
+			if ok(list.Rooms) {
+				return list.Rooms
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for room list")
+		}
+	}
+}
+
+func TestRoomListMetadata(t *testing.T) {
+	h := NewHub()
+	c1, _ := newTestClient(h, "p1")
+	c2, _ := newTestClient(h, "p2")
+	lobby, rl := newTestClient(h, "p3")
+
+	send(t, lobby, EventJoinRoom, JoinRoomEvent{Room: "hidden", Settings: &RoomSettings{Visibility: "secret"}})
+	expectError(t, rl, CodeInvalidSettings, EventJoinRoom)
+
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	rooms := waitForRooms(t, rl, func(rooms []RoomInfo) bool { return len(rooms) == 1 && rooms[0].Players == 1 })
+	info := rooms[0]
+	if info.Name != "arena" || info.Owner != "p1" || info.OwnerName != "p1" || info.Ruleset != "standard" ||
+		info.Visibility != VisibilityPublic || info.Seats != 2 || info.Status != RoomWaiting || info.Created.IsZero() {
+		t.Errorf("Unexpected room info %+v", info)
+	}
+
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	waitForRooms(t, rl, func(rooms []RoomInfo) bool {
+		return len(rooms) == 1 && rooms[0].Players == 2 && rooms[0].Status == RoomPlaying
+	})
+
+	send(t, c1, EventLeaveRoom, nil)
+	waitForRooms(t, rl, func(rooms []RoomInfo) bool { return len(rooms) == 1 && rooms[0].Status == RoomFinished })
+
+	if err := send(t, lobby, EventListRooms, nil); err != nil {
+		t.Fatalf("failed to list rooms: %v", err)
+	}
+	rooms = waitForRooms(t, rl, func([]RoomInfo) bool { return true })
+	if len(rooms) != 1 || rooms[0].Owner != "p1" || rooms[0].Players != 1 {
+		t.Errorf("Expected the finished room owned by p1 with p2 still seated, got %+v", rooms)
+	}
+}
+
+func TestIdleRoomClosed(t *testing.T) {
+	h := NewHub()
+	h.idleTimeout = 50 * time.Millisecond
+	c1, r1 := newTestClient(h, "p1")
+
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	waitFor(t, r1, EventRoomClosed)
+	for deadline := time.Now().Add(time.Second); ; {
+		if _, ok := h.findRoom("arena"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the idle room to be deleted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The client is back in the lobby, so sees the room list change
+	if room := h.clientRoom(c1); room != "" {
+		t.Errorf("Expected the client to be back in the lobby, still in %q", room)
+	}
+	send(t, c1, EventLeaveRoom, nil)
+	expectError(t, r1, CodeNotInRoom, EventLeaveRoom)
+	c2, _ := newTestClient(h, "p2")
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "lounge"})
+	waitForRooms(t, r1, func(rooms []RoomInfo) bool { return len(rooms) == 1 && rooms[0].Name == "lounge" })
+}
+
+func TestPlayingRoomNotIdle(t *testing.T) {
+	h := NewHub()
+	h.idleTimeout = 50 * time.Millisecond
+	c1, r1 := newTestClient(h, "p1")
+	c2, _ := newTestClient(h, "p2")
+
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	time.Sleep(150 * time.Millisecond)
+	if _, ok := h.findRoom("arena"); !ok {
+		t.Fatalf("Expected the room with a game in progress to stay open")
+	}
+	for {
+		select {
+		case event := <-r1:
+			if event.Type == EventRoomClosed {
+				t.Fatalf("Expected no room_closed while playing")
+			}
+			continue
+		default:
+		}
+		break
+	}
+}
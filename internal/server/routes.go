@@ -2,8 +2,13 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+
+	"prisoner-fencing/internal/database"
 )
 
 func (s *Server) RegisterRoutes() http.Handler {
@@ -18,9 +23,36 @@ func (s *Server) RegisterRoutes() http.Handler {
 	mux.HandleFunc("/", s.HelloWorldHandler)
 
 	mux.HandleFunc("/health", s.healthHandler)
+	mux.HandleFunc("GET /matches/{id}", s.matchHandler)
+	mux.HandleFunc("GET /matches/{id}/replay", s.replayHandler)
+	mux.HandleFunc("GET /series/{id}", s.seriesHandler)
+	mux.HandleFunc("GET /players/{id}/matches", s.playerMatchesHandler)
+	mux.HandleFunc("GET /players/{id}/ratings", s.ratingHistoryHandler)
+	mux.HandleFunc("GET /leaderboard", s.leaderboardHandler)
+	mux.HandleFunc("POST /sessions/refresh", s.refreshSessionHandler)
+	mux.HandleFunc("POST /players", s.registerHandler)
+	mux.HandleFunc("PUT /players/me", s.updateProfileHandler)
+	mux.HandleFunc("GET /players/{id}", s.profileHandler)
+	mux.HandleFunc("GET /avatars", s.avatarsHandler)
+	mux.HandleFunc("GET /tournaments", s.tournamentsHandler)
+	mux.HandleFunc("POST /tournaments", s.createTournamentHandler)
+	mux.HandleFunc("GET /tournaments/{id}", s.tournamentHandler)
+	mux.HandleFunc("POST /tournaments/{id}/entrants", s.enterTournamentHandler)
+	mux.HandleFunc("POST /tournaments/{id}/start", s.startTournamentHandler)
 	//mux.HandleFunc("/ws", s.websocketHandler)
 	hub := NewHub()
+	hub.reconnectGrace = s.reconnectGrace
+	hub.idleTimeout = s.idleTimeout
+	hub.defaultSettings.Timer.Seconds = s.turnSeconds
+	hub.rulesets = s.rulesets
+	hub.db = s.db
+	if s.sessions == nil {
+		s.sessions = newSessions(s.sessionSecret)
+	}
+	hub.sessions = s.sessions
+	s.hub = hub
 	mux.HandleFunc("/ws", hub.serveWS)
+	mux.HandleFunc("/rulesets", hub.rulesetsHandler)
 
 	// Wrap the mux with CORS middleware
 	return s.corsMiddleware(mux)
@@ -69,3 +101,102 @@ func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Failed to write response: %v", err)
 	}
 }
+
+func (s *Server) matchHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid match id", http.StatusBadRequest)
+		return
+	}
+	match, err := s.db.GetMatch(r.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "Match not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get match: %v", err)
+		http.Error(w, "Failed to get match", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, match)
+}
+
+func (s *Server) seriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid series id", http.StatusBadRequest)
+		return
+	}
+	series, err := s.db.GetSeries(r.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "Series not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get series: %v", err)
+		http.Error(w, "Failed to get series", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, series)
+}
+
+// maxPlayerMatches caps how many matches a player's history returns.
+const maxPlayerMatches = 50
+
+func (s *Server) playerMatchesHandler(w http.ResponseWriter, r *http.Request) {
+	matches, err := s.db.ListMatchesByPlayer(r.Context(), r.PathValue("id"), maxPlayerMatches)
+	if err != nil {
+		log.Printf("Failed to list matches: %v", err)
+		http.Error(w, "Failed to list matches", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, matches)
+}
+
+// Leaderboard sizes, chosen with the limit query parameter.
+const (
+	defaultLeaderboardSize = 10
+	maxLeaderboardSize     = 100
+)
+
+func (s *Server) leaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	limit := defaultLeaderboardSize
+	if param := r.URL.Query().Get("limit"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 || n > maxLeaderboardSize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxLeaderboardSize), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	ratings, err := s.db.TopRatings(r.Context(), limit)
+	if err != nil {
+		log.Printf("Failed to get leaderboard: %v", err)
+		http.Error(w, "Failed to get leaderboard", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, ratings)
+}
+
+func (s *Server) ratingHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	changes, err := s.db.RatingHistory(r.Context(), r.PathValue("id"), maxPlayerMatches)
+	if err != nil {
+		log.Printf("Failed to get rating history: %v", err)
+		http.Error(w, "Failed to get rating history", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, changes)
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(resp); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
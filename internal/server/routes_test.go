@@ -1,10 +1,18 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"prisoner-fencing/internal/database"
+	"prisoner-fencing/internal/engine"
 )
 
 func TestHandler(t *testing.T) {
@@ -29,3 +37,115 @@ func TestHandler(t *testing.T) {
 		t.Errorf("expected response body to be %v; got %v", expected, string(body))
 	}
 }
+
+func TestLeaderboardHandler(t *testing.T) {
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	now := time.Now()
+	if _, err := db.SaveMatch(context.Background(), database.Match{
+		Room: "arena", Ruleset: "standard", StartedAt: now, EndedAt: now, Winner: 2, Reason: ReasonElimination, Rated: true,
+		Participants: []database.Participant{{Seat: 1, PlayerId: "p1"}, {Seat: 2, PlayerId: "p2"}},
+	}); err != nil {
+		t.Fatalf("failed to save match: %v", err)
+	}
+
+	s := &Server{db: db}
+	server := httptest.NewServer(s.RegisterRoutes())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/leaderboard?limit=1")
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	defer resp.Body.Close()
+	var top []database.Rating
+	if err := json.NewDecoder(resp.Body).Decode(&top); err != nil {
+		t.Fatalf("error decoding response body. Err: %v", err)
+	}
+	if len(top) != 1 || top[0].PlayerId != "p2" {
+		t.Errorf("expected p2 alone at the top; got %+v", top)
+	}
+
+	resp, err = http.Get(server.URL + "/players/p1/ratings")
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	defer resp.Body.Close()
+	var history []database.RatingChange
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		t.Fatalf("error decoding response body. Err: %v", err)
+	}
+	if len(history) != 1 || history[0].After >= history[0].Before {
+		t.Errorf("expected p1 to have lost rating; got %+v", history)
+	}
+
+	resp, err = http.Get(server.URL + "/leaderboard?limit=1000")
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status Bad Request for a huge limit; got %v", resp.Status)
+	}
+}
+
+func TestReplayHandler(t *testing.T) {
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	rules := engine.DefaultRuleset()
+	start := engine.NewState(rules)
+	next, outcomes := engine.Resolve(start, engine.ActionWait, engine.ActionAdvance)
+	now := time.Now()
+	id, err := db.SaveMatch(context.Background(), database.Match{
+		Room: "arena", Ruleset: rules.Name, Rules: rules, StartedAt: now, EndedAt: now, Winner: 1, Reason: ReasonForfeit, TurnCount: 1,
+		Participants: []database.Participant{{Seat: 1, PlayerId: "p1"}, {Seat: 2, PlayerId: "p2"}},
+		Turns: []database.Turn{{
+			Turn:    1,
+			Actions: [2]engine.Action{engine.ActionWait, engine.ActionAdvance},
+			Players: [2]database.TurnPlayer{
+				{Before: start.Players[0], After: next.Players[0]},
+				{Before: start.Players[1], After: next.Players[1]},
+			},
+			Outcomes: outcomes,
+		}},
+	})
+	if err != nil {
+		t.Fatalf("failed to save match: %v", err)
+	}
+
+	s := &Server{db: db}
+	server := httptest.NewServer(s.RegisterRoutes())
+	defer server.Close()
+
+	resp, err := http.Get(fmt.Sprintf("%s/matches/%d/replay", server.URL, id))
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	defer resp.Body.Close()
+	var replay Replay
+	if err := json.NewDecoder(resp.Body).Decode(&replay); err != nil {
+		t.Fatalf("error decoding response body. Err: %v", err)
+	}
+	if replay.Version != replayVersion || replay.Players != [2]string{"p1", "p2"} || replay.Rules.BoardWidth != rules.BoardWidth {
+		t.Errorf("expected the replay header; got %+v", replay)
+	}
+	if replay.Start != start.Players || len(replay.Turns) != 1 || replay.Turns[0].After != next.Players || len(replay.Turns[0].Outcomes) != len(outcomes) {
+		t.Errorf("expected the turn timeline; got %+v", replay.Turns)
+	}
+
+	resp, err = http.Get(server.URL + "/matches/999/replay")
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status Not Found for a missing match; got %v", resp.Status)
+	}
+}
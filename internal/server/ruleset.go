@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"prisoner-fencing/internal/engine"
+)
+
+// defaultRulesetsDir is where rulesets are loaded from unless RULESETS_DIR
+// says otherwise.
+const defaultRulesetsDir = "rulesets"
+
+// loadRulesets reads every .json, .yaml and .yml file in dir as a ruleset.
+// Values a file leaves out are taken from the standard ruleset, and a file
+// without a name is named after itself. The standard ruleset is always
+// available and cannot be replaced, and a missing dir only leaves that one.
+func loadRulesets(dir string) (map[string]engine.Ruleset, error) {
+	rulesets := map[string]engine.Ruleset{engine.DefaultRulesetName: engine.DefaultRuleset()}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return rulesets, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rulesets dir: %v", err)
+	}
+	files := make(map[string]string) // ruleset name -> file it came from
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".json" && ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ruleset %s: %v", entry.Name(), err)
+		}
+		if ext != ".json" {
+			if data, err = yamlToJSON(data); err != nil {
+				return nil, fmt.Errorf("failed to parse ruleset %s: %v", entry.Name(), err)
+			}
+		}
+
+		rules := engine.DefaultRuleset()
+		rules.Name = strings.TrimSuffix(entry.Name(), ext)
+		if err := json.Unmarshal(data, &rules); err != nil {
+			return nil, fmt.Errorf("failed to parse ruleset %s: %v", entry.Name(), err)
+		}
+		if err := rules.Validate(); err != nil {
+			return nil, err
+		}
+		if rules.Name == engine.DefaultRulesetName {
+			return nil, fmt.Errorf("ruleset %s: the %s ruleset is built in and cannot be replaced", entry.Name(), rules.Name)
+		}
+		if other, ok := files[rules.Name]; ok {
+			return nil, fmt.Errorf("ruleset %s: %s already defines ruleset %s", entry.Name(), other, rules.Name)
+		}
+		files[rules.Name] = entry.Name()
+		rulesets[rules.Name] = rules
+		log.Printf("Loaded ruleset %s from %s", rules.Name, entry.Name())
+	}
+	return rulesets, nil
+}
+
+// yamlToJSON converts a YAML ruleset to JSON, so it is read with the same
+// field names as a JSON one. A key given twice is an error.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var fields map[string]any
+	if err := yaml.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		fields = make(map[string]any)
+	}
+	return json.Marshal(fields)
+}
+
+// ruleset returns the ruleset called name, the standard one if name is empty.
+func (h *Hub) ruleset(name string) (engine.Ruleset, error) {
+	if name == "" {
+		name = engine.DefaultRulesetName
+	}
+	rules, ok := h.rulesets[name]
+	if !ok {
+		return engine.Ruleset{}, fmt.Errorf("unknown ruleset: %s", name)
+	}
+	return rules, nil
+}
+
+// rulesetsHandler lists the rulesets a room can be created with.
+func (h *Hub) rulesetsHandler(w http.ResponseWriter, r *http.Request) {
+	list := make([]engine.Ruleset, 0, len(h.rulesets))
+	for _, rules := range h.rulesets {
+		list = append(list, rules)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	writeJSON(w, list)
+}
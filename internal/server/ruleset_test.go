@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"prisoner-fencing/internal/engine"
+)
+
+func TestLoadRulesets(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"long-board.json": `{"boardWidth": 11, "startPos": [3, 7]}`,
+		"sd.yaml":         "# one hit: \"#\" is only a comment outside quotes\nname: \"sudden-death\"\nstartEnergy: 3\nmaxTurns: 10\nstartPos: [1, 5]\n",
+		"notes.txt":       "not a ruleset",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	rulesets, err := loadRulesets(dir)
+	if err != nil {
+		t.Fatalf("failed to load rulesets: %v", err)
+	}
+	if len(rulesets) != 3 {
+		t.Errorf("Expected 3 rulesets, got %d", len(rulesets))
+	}
+	long := rulesets["long-board"]
+	if long.BoardWidth != 11 || long.StartPos != [2]int{3, 7} || long.StartEnergy != engine.StartEnergy {
+		t.Errorf("Expected long-board to override only the board, got %+v", long)
+	}
+	if sd := rulesets["sudden-death"]; sd.StartEnergy != 3 || sd.MaxTurns != 10 {
+		t.Errorf("Expected sudden-death to be read from YAML, got %+v", sd)
+	}
+
+	bad := map[string]string{
+		"broken.json":       `{"boardWidth": 2}`,
+		"sudden-death.json": `{"startEnergy": 5}`,
+		"mine.json":         `{"name": "standard", "startEnergy": 5}`,
+		"standard.json":     `{"startEnergy": 5}`,
+		"twice.yaml":        "name: twice\nmaxTurns: 10\nmaxTurns: 20\n",
+		"bad.yml":           "name: [unclosed\n",
+	}
+	for name, content := range bad {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		if _, err := loadRulesets(dir); err == nil {
+			t.Errorf("Expected the rulesets with %s to be rejected", name)
+		}
+		os.Remove(path)
+	}
+}
+
+func TestShippedRulesets(t *testing.T) {
+	rulesets, err := loadRulesets(filepath.Join("..", "..", defaultRulesetsDir))
+	if err != nil {
+		t.Fatalf("failed to load the shipped rulesets: %v", err)
+	}
+	for _, name := range []string{engine.DefaultRulesetName, "long-board", "sudden-death"} {
+		if _, ok := rulesets[name]; !ok {
+			t.Errorf("Expected the %s ruleset to be shipped", name)
+		}
+	}
+}
+
+func TestRoomUsesRuleset(t *testing.T) {
+	h := NewHub()
+	long := engine.DefaultRuleset()
+	long.Name, long.BoardWidth, long.StartPos = "long-board", 11, [2]int{3, 7}
+	h.rulesets[long.Name] = long
+
+	c1, r1 := newTestClient(h, "p1")
+	if err := send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena", Settings: &RoomSettings{Ruleset: "long-board"}}); err != nil {
+		t.Fatalf("failed to join room: %v", err)
+	}
+
+	var gs GameState
+	if err := json.Unmarshal(waitFor(t, r1, "GAME_ACTION_RESULT").Payload, &gs); err != nil {
+		t.Fatalf("failed to unmarshal game state: %v", err)
+	}
+	if gs.Ruleset.Name != "long-board" || gs.Ruleset.BoardWidth != 11 || gs.PlayerStates["you"].Pos != 3 {
+		t.Errorf("Expected the long-board ruleset and start position, got %+v", gs)
+	}
+
+	c2, _ := newTestClient(h, "p2")
+	if err := send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "other", Settings: &RoomSettings{Ruleset: "missing"}}); err == nil {
+		t.Errorf("Expected an unknown ruleset to be rejected")
+	}
+}
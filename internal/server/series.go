@@ -0,0 +1,251 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"prisoner-fencing/internal/database"
+	"prisoner-fencing/internal/engine"
+)
+
+// A room's games are played in best-of series, of a single game unless the
+// room's settings ask for more. Once a game is over its players can both send
+// rematch to play the next one with sides swapped, which starts a new series
+// if the last one is decided. A series ends early when either player leaves,
+// and a finished series of more than one game is stored.
+
+// SeriesScore is the score of a best-of series, in GameState.
+type SeriesScore struct {
+	BestOf int            `json:"bestOf"`
+	Game   int            `json:"game"` // number of the game being played, or of the last one
+	Wins   map[string]int `json:"wins"` // keyed like PlayerStates
+	Over   bool           `json:"over"`
+}
+
+// series keeps score over the games two players play in a room.
+type series struct {
+	bestOf    int
+	players   [2]string      // ids of player 1 and player 2 of the first game
+	wins      map[string]int // player id -> games won
+	games     int            // games finished
+	matches   []int64        // ids of the stored matches
+	startedAt time.Time
+	forfeited string // id of the player who left, ending the series
+	over      bool
+}
+
+// has reports whether player id plays in the series.
+func (s *series) has(id string) bool {
+	return id == s.players[0] || id == s.players[1]
+}
+
+// decided reports whether a player has won the majority of the games, or
+// there are none left to play.
+func (s *series) decided() bool {
+	need := s.bestOf/2 + 1
+	return s.forfeited != "" || s.wins[s.players[0]] >= need || s.wins[s.players[1]] >= need || s.games >= s.bestOf
+}
+
+// winner returns 1 or 2 for the winner among s.players, 0 for a draw.
+func (s *series) winner() int {
+	switch {
+	case s.forfeited == s.players[0]:
+		return 2
+	case s.forfeited == s.players[1]:
+		return 1
+	case s.wins[s.players[0]] > s.wins[s.players[1]]:
+		return 1
+	case s.wins[s.players[1]] > s.wins[s.players[0]]:
+		return 2
+	}
+	return 0
+}
+
+func RematchHandler(event Event, c *Client) error {
+	var payload struct {
+		Room string `json:"room"`
+	}
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return handlerError(CodeBadRequest, "failed to unmarshal rematch: %v", err)
+	}
+
+	room, err := gameRoom(c, payload.Room)
+	if err != nil {
+		return err
+	}
+	if err := room.send(roomCommand{kind: commandRematch, client: c, id: c.id}); err != nil {
+		return err
+	}
+	return ack(event, c)
+}
+
+// beginGame starts the game between seated players ids, as the next of their
+// series if they are playing one.
+func (r *Room) beginGame(ids [2]string) {
+	gs := r.state
+	gs.startedAt = time.Now()
+	r.startTurnTimer()
+	r.last = ids
+	r.lastNames = [2]string{gs.PlayerStates[ids[0]].Name, gs.PlayerStates[ids[1]].Name}
+	clear(r.wantRematch)
+
+	if s := r.series; s == nil || s.over || !s.has(ids[0]) || !s.has(ids[1]) {
+		r.series = &series{bestOf: r.settings.BestOf, players: ids, wins: make(map[string]int), startedAt: gs.startedAt}
+	}
+}
+
+// scoreGame counts the game between ids that just ended, stored as match,
+// towards their series. A player who forfeits the game forfeits the series.
+func (r *Room) scoreGame(ids [2]string, result engine.Result, reason string, match int64) {
+	s := r.series
+	if s == nil || s.over {
+		return
+	}
+	s.games++
+	if result.Winner != 0 {
+		s.wins[ids[result.Winner-1]]++
+	}
+	if match != 0 {
+		s.matches = append(s.matches, match)
+	}
+	if result.Winner != 0 && (reason == ReasonForfeit || reason == ReasonDisconnect) {
+		s.forfeited = ids[2-result.Winner]
+	}
+	if s.decided() {
+		r.endSeries(reason)
+	}
+}
+
+// seriesPending reports whether the players of the last game still have games
+// of their series to play, so their seats are kept for the next one.
+func (r *Room) seriesPending() bool {
+	return r.state == nil && r.last[0] != "" && r.series != nil && !r.series.over
+}
+
+// abandonSeries ends the series when player id leaves the room between its
+// games, and tells their opponent there is no rematch.
+func (r *Room) abandonSeries(id string) {
+	if r.last[0] != id && r.last[1] != id {
+		return
+	}
+	if r.state != nil {
+		if _, seated := r.state.PlayerStates[id]; seated {
+			return // Leaving a game in progress forfeits it instead
+		}
+	}
+	for _, other := range r.clients {
+		if other == id {
+			return // Still here on another connection
+		}
+	}
+	r.last = [2]string{}
+	clear(r.wantRematch)
+	r.emit(Event{
+		Type:    "UPDATE_STATUS",
+		Payload: json.RawMessage(`{"status": "Opponent left the room, no rematch"}`),
+	})
+
+	if s := r.series; s != nil && !s.over && s.has(id) {
+		s.forfeited = id
+		r.endSeries(ReasonForfeit)
+	}
+}
+
+// endSeries finishes the series, for the given reason, stores it and hands
+// the result to the room's tournament.
+func (r *Room) endSeries(reason string) {
+	s := r.series
+	s.over = true
+	var stored int64
+	if r.settings.tournamentId != "" {
+		defer func() { r.reportTournament(s, stored) }()
+	}
+	if r.hub.db == nil || s.bestOf <= 1 || s.games == 0 {
+		return
+	}
+
+	record := database.Series{
+		Room:      r.name,
+		BestOf:    s.bestOf,
+		StartedAt: s.startedAt,
+		EndedAt:   time.Now(),
+		Players:   s.players,
+		Wins:      [2]int{s.wins[s.players[0]], s.wins[s.players[1]]},
+		Winner:    s.winner(),
+		Reason:    reason,
+		Matches:   s.matches,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+	defer cancel()
+	var err error
+	if stored, err = r.hub.db.SaveSeries(ctx, record); err != nil {
+		log.Printf("Failed to save series in room %s: %v", r.name, err)
+	}
+}
+
+// rematch records that player id wants to play the players of the last game
+// again, and starts the game with sides swapped once both do.
+func (r *Room) rematch(c *Client, id string) error {
+	if r.state != nil && len(r.state.PlayerStates) > 0 {
+		return handlerError(CodeWrongPhase, "a game is under way in room: %s", r.name)
+	}
+	if r.last[0] == "" {
+		return handlerError(CodeWrongPhase, "no game to rematch in room: %s", r.name)
+	}
+	// A tournament match is only played again to settle a draw
+	if s := r.series; r.settings.tournamentId != "" && s != nil && s.over && (s.winner() != 0 || !r.settings.replayDraws) {
+		return handlerError(CodeWrongPhase, "the tournament match in room %s is over", r.name)
+	}
+	if r.spectators[c] || id != r.last[0] && id != r.last[1] {
+		return handlerError(CodeNotSeated, "only the players of the last game can ask for a rematch")
+	}
+	opponent := r.last[0]
+	if id == opponent {
+		opponent = r.last[1]
+	}
+	if r.wantRematch[id] {
+		return handlerError(CodeAlreadySubmitted, "already asked for a rematch")
+	}
+	r.wantRematch[id] = true
+
+	if !r.wantRematch[opponent] {
+		for client, clientId := range r.clients {
+			status := `{"status": "Waiting for opponent to accept the rematch"}`
+			if clientId == opponent {
+				status = `{"status": "Opponent wants a rematch"}`
+			} else if clientId != id {
+				continue
+			}
+			emit(Event{Type: "UPDATE_STATUS", Payload: json.RawMessage(status)}, client)
+		}
+		return nil
+	}
+
+	ids, names := r.last, r.lastNames
+	r.state = newGameState(r.settings.rules)
+	r.gameOver = false
+	r.state.seat(ids[1], names[1])
+	r.state.seat(ids[0], names[0])
+	r.beginGame([2]string{ids[1], ids[0]})
+	r.broadcast(engine.Result{}, "", false)
+	return nil
+}
+
+// seriesScore returns the score of the series in progress with the players
+// ids keyed as keys, or nil if the room plays single games.
+func (r *Room) seriesScore(ids, keys [2]string) *SeriesScore {
+	s := r.series
+	if s == nil || s.bestOf <= 1 {
+		return nil
+	}
+	score := &SeriesScore{BestOf: s.bestOf, Game: s.games, Wins: make(map[string]int), Over: s.over}
+	if r.state != nil && !r.state.GameOver {
+		score.Game++
+	}
+	for i, id := range ids {
+		score.Wins[keys[i]] = s.wins[id]
+	}
+	return score
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"prisoner-fencing/internal/database"
+	"prisoner-fencing/internal/engine"
+)
+
+// newSeriesHub returns a hub with a one turn ruleset, so games end quickly.
+func newSeriesHub() *Hub {
+	h := NewHub()
+	short := engine.DefaultRuleset()
+	short.Name, short.MaxTurns = "short", 0
+	h.rulesets[short.Name] = short
+	return h
+}
+
+// playGame plays the one turn game in room so that winner wins by energy,
+// and returns the final state winner is sent.
+func playGame(t *testing.T, winner, loser *Client, received chan Event, room string) GameState {
+	t.Helper()
+	send(t, winner, EventGameAction, map[string]string{"room": room, "action": "WAIT"})
+	send(t, loser, EventGameAction, map[string]string{"room": room, "action": "RETREAT"})
+	return waitForState(t, received, func(gs GameState) bool { return gs.GameOver })
+}
+
+func TestRematchSwapsSides(t *testing.T) {
+	h := newSeriesHub()
+	c1, r1 := newTestClient(h, "p1")
+	c2, r2 := newTestClient(h, "p2")
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena", Settings: &RoomSettings{Ruleset: "short"}})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+
+	gs := playGame(t, c1, c2, r1, "arena")
+	if gs.Series != nil {
+		t.Errorf("Expected no series score for single games, got %+v", gs.Series)
+	}
+
+	if err := send(t, c1, EventRematch, map[string]string{"room": "arena"}); err != nil {
+		t.Fatalf("Failed to ask for a rematch: %v", err)
+	}
+	send(t, c1, EventRematch, map[string]string{"room": "arena"})
+	expectError(t, r1, CodeAlreadySubmitted, EventRematch)
+	waitFor(t, r2, "UPDATE_STATUS")
+
+	if err := send(t, c2, EventRematch, map[string]string{"room": "arena"}); err != nil {
+		t.Fatalf("Failed to accept the rematch: %v", err)
+	}
+	gs = waitForState(t, r1, func(gs GameState) bool { return !gs.GameOver && len(gs.PlayerStates) == 2 })
+	if gs.PlayerStates["you"].Player != 2 || gs.PlayerStates["opponent"].Player != 1 {
+		t.Errorf("Expected p1 to play as player 2 in the rematch, got %+v", gs.PlayerStates)
+	}
+
+	send(t, c1, EventRematch, map[string]string{"room": "arena"})
+	expectError(t, r1, CodeWrongPhase, EventRematch)
+}
+
+func TestRematchNeedsOpponent(t *testing.T) {
+	h := newSeriesHub()
+	c1, r1 := newTestClient(h, "p1")
+	c2, r2 := newTestClient(h, "p2")
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena", Settings: &RoomSettings{Ruleset: "short"}})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	playGame(t, c1, c2, r1, "arena")
+	waitForState(t, r2, func(gs GameState) bool { return gs.GameOver })
+
+	send(t, c2, EventLeaveRoom, nil)
+	waitFor(t, r1, "UPDATE_STATUS")
+	send(t, c1, EventRematch, map[string]string{"room": "arena"})
+	expectError(t, r1, CodeWrongPhase, EventRematch)
+}
+
+func TestBestOfThreeSeries(t *testing.T) {
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	h := newSeriesHub()
+	h.db = db
+
+	c1, r1 := newTestClient(h, "p1")
+	c2, r2 := newTestClient(h, "p2")
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena", Settings: &RoomSettings{Ruleset: "short", BestOf: 3}})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	gs := waitForState(t, r1, func(gs GameState) bool { return len(gs.PlayerStates) == 2 })
+	if gs.Series == nil || gs.Series.BestOf != 3 || gs.Series.Game != 1 {
+		t.Fatalf("Expected game 1 of a best of 3, got %+v", gs.Series)
+	}
+
+	// rematch starts the next game, which both players see as the given one
+	rematch := func(game int) GameState {
+		t.Helper()
+		send(t, c1, EventRematch, map[string]string{"room": "arena"})
+		if err := send(t, c2, EventRematch, map[string]string{"room": "arena"}); err != nil {
+			t.Fatalf("Failed to start the next game: %v", err)
+		}
+		next := func(gs GameState) bool { return !gs.GameOver && gs.Series != nil && gs.Series.Game == game }
+		waitForState(t, r2, next)
+		return waitForState(t, r1, next)
+	}
+
+	gs = playGame(t, c1, c2, r1, "arena")
+	if gs.Series.Wins["you"] != 1 || gs.Series.Wins["opponent"] != 0 || gs.Series.Over {
+		t.Errorf("Expected p1 to lead 1-0, got %+v", gs.Series)
+	}
+	rematch(2)
+	gs = playGame(t, c2, c1, r2, "arena")
+	if gs.Series.Wins["you"] != 1 || gs.Series.Wins["opponent"] != 1 || gs.Series.Game != 2 {
+		t.Errorf("Expected 1-1 after game 2, got %+v", gs.Series)
+	}
+	rematch(3)
+	gs = playGame(t, c1, c2, r1, "arena")
+	if gs.Series.Wins["you"] != 2 || !gs.Series.Over {
+		t.Errorf("Expected p1 to win the series 2-1, got %+v", gs.Series)
+	}
+
+	series, err := db.GetSeries(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Expected the series to be stored: %v", err)
+	}
+	if series.BestOf != 3 || series.Players != [2]string{"p1", "p2"} || series.Wins != [2]int{2, 1} || series.Winner != 1 || len(series.Matches) != 3 {
+		t.Errorf("Expected p1 to win the stored series 2-1, got %+v", series)
+	}
+
+	// A new series starts after a decided one
+	gs = rematch(1)
+	if gs.Series.Over || gs.Series.Wins["you"] != 0 {
+		t.Errorf("Expected a fresh series, got %+v", gs.Series)
+	}
+}
+
+func TestSeriesSeatsKeptBetweenGames(t *testing.T) {
+	h := newSeriesHub()
+	c1, r1 := newTestClient(h, "p1")
+	c2, r2 := newTestClient(h, "p2")
+	c3, r3 := newTestClient(h, "p3")
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena", Settings: &RoomSettings{Ruleset: "short", BestOf: 3}})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	playGame(t, c1, c2, r1, "arena")
+	waitForState(t, r2, func(gs GameState) bool { return gs.GameOver })
+
+	if err := send(t, c3, EventJoinRoom, JoinRoomEvent{Room: "arena"}); err != nil {
+		t.Fatalf("Failed to join between games: %v", err)
+	}
+	waitFor(t, r3, "UPDATE_STATUS")
+
+	send(t, c1, EventRematch, map[string]string{"room": "arena"})
+	if err := send(t, c2, EventRematch, map[string]string{"room": "arena"}); err != nil {
+		t.Fatalf("Failed to start the next game: %v", err)
+	}
+	gs := waitForState(t, r1, func(gs GameState) bool { return !gs.GameOver && len(gs.PlayerStates) == 2 })
+	if gs.Series == nil || gs.Series.Game != 2 || gs.PlayerStates["you"].Player != 2 {
+		t.Errorf("Expected p1 to play game 2 of the series as player 2, got %+v", gs)
+	}
+	gs = waitForState(t, r3, func(gs GameState) bool { return len(gs.PlayerStates) == 2 })
+	if _, watching := gs.PlayerStates["player1"]; !watching {
+		t.Errorf("Expected p3 to watch game 2, got %+v", gs.PlayerStates)
+	}
+}
+
+func TestSeriesForfeitedOnLeave(t *testing.T) {
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	h := newSeriesHub()
+	h.db = db
+
+	c1, r1 := newTestClient(h, "p1")
+	c2, _ := newTestClient(h, "p2")
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena", Settings: &RoomSettings{Ruleset: "short", BestOf: 5}})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	playGame(t, c2, c1, r1, "arena")
+
+	send(t, c2, EventLeaveRoom, nil)
+	waitFor(t, r1, "UPDATE_STATUS")
+	series, err := db.GetSeries(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Expected the abandoned series to be stored: %v", err)
+	}
+	if series.Winner != 1 || series.Reason != ReasonForfeit || series.Wins != [2]int{0, 1} {
+		t.Errorf("Expected p1 to win the series by forfeit, got %+v", series)
+	}
+}
+
+func TestInvalidBestOfRejected(t *testing.T) {
+	h := NewHub()
+	c, received := newTestClient(h, "p1")
+	send(t, c, EventJoinRoom, JoinRoomEvent{Room: "arena", Settings: &RoomSettings{BestOf: 4}})
+	expectError(t, received, CodeInvalidSettings, EventJoinRoom)
+}
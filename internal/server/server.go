@@ -2,6 +2,7 @@ package server
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"strconv"
@@ -10,12 +11,21 @@ import (
 	_ "github.com/joho/godotenv/autoload"
 
 	"prisoner-fencing/internal/database"
+	"prisoner-fencing/internal/engine"
 )
 
 type Server struct {
 	port int
 
 	db database.Service
+
+	reconnectGrace time.Duration
+	idleTimeout    time.Duration
+	turnSeconds    int
+	rulesets       map[string]engine.Ruleset
+	sessionSecret  string
+	sessions       *sessions
+	hub            *Hub
 }
 
 func NewServer() *http.Server {
@@ -24,6 +34,34 @@ func NewServer() *http.Server {
 		port: port,
 
 		db: database.New(),
+
+		reconnectGrace: defaultReconnectGrace,
+		idleTimeout:    defaultIdleTimeout,
+	}
+	if grace, err := strconv.Atoi(os.Getenv("RECONNECT_GRACE_SECONDS")); err == nil {
+		NewServer.reconnectGrace = time.Duration(grace) * time.Second
+	}
+	if idle, err := strconv.Atoi(os.Getenv("ROOM_IDLE_SECONDS")); err == nil {
+		NewServer.idleTimeout = time.Duration(idle) * time.Second
+	}
+	NewServer.turnSeconds, _ = strconv.Atoi(os.Getenv("TURN_TIMEOUT_SECONDS"))
+	rulesetsDir := os.Getenv("RULESETS_DIR")
+	if rulesetsDir == "" {
+		rulesetsDir = defaultRulesetsDir
+	}
+	rulesets, err := loadRulesets(rulesetsDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	NewServer.rulesets = rulesets
+	// Without a secret every token dies with the server, which is only fine
+	// in local development
+	NewServer.sessionSecret = os.Getenv("SESSION_SECRET")
+	if NewServer.sessionSecret == "" {
+		if os.Getenv("APP_ENV") != "local" {
+			log.Fatal("SESSION_SECRET must be set unless APP_ENV is local")
+		}
+		log.Printf("SESSION_SECRET is not set, sessions will not survive a restart")
 	}
 
 	// Declare Server config
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"prisoner-fencing/internal/engine"
+)
+
+// Spectators are clients in a room who watch rather than play: those who
+// joined with spectate set, and those who are not seated in the game. They
+// see both players as "player1" and "player2", and with a spectator delay
+// they only see a turn once that many more have been played, so they cannot
+// tell a player what the opponent is doing.
+
+// spectating reports whether client c, player id, watches the room rather
+// than plays in it.
+func (r *Room) spectating(c *Client, id string) bool {
+	if r.spectators[c] {
+		return true
+	}
+	if r.state == nil {
+		return false
+	}
+	_, seated := r.state.PlayerStates[id]
+	return !seated
+}
+
+// spectatorCount returns the number of clients watching the room.
+func (r *Room) spectatorCount() int {
+	n := 0
+	for client, id := range r.clients {
+		if r.spectating(client, id) {
+			n++
+		}
+	}
+	return n
+}
+
+// emitSpectatorCount tells everyone in the room how many are watching.
+func (r *Room) emitSpectatorCount() {
+	r.emit(Event{
+		Type:    "SPECTATOR_COUNT",
+		Payload: json.RawMessage(fmt.Sprintf(`{"spectators": %d}`, r.spectatorCount())),
+	})
+}
+
+// spectatorView returns the game state as spectators see it. Unless reveal is
+// set, the actions chosen for the coming turn are hidden.
+func (r *Room) spectatorView(result engine.Result, reason string, reveal bool) GameState {
+	gs := r.state
+	ids, _ := gs.seats()
+	view := gs.spectate(ids)
+	view.CommitReveal = r.settings.CommitReveal
+	view.TieBreak = r.settings.TieBreak
+	view.Casual = r.settings.Casual || r.settings.Bot != ""
+	view.Spectators = r.spectatorCount()
+	view.Series = r.seriesScore(ids, [2]string{"player1", "player2"})
+	view.Winner = spectatorWinnerMessage(result, reason, [2]string{gs.PlayerStates[ids[0]].Name, gs.PlayerStates[ids[1]].Name})
+	view.Reason = reason
+	for key, ps := range view.PlayerStates {
+		if !reveal {
+			ps.Action, ps.Nonce = "", ""
+		}
+		view.PlayerStates[key] = ps
+	}
+	// A delayed view would show a deadline long gone
+	if !r.turnDeadline.IsZero() && r.settings.SpectatorDelay <= 0 {
+		view.TimeLeft = time.Until(r.turnDeadline).Milliseconds()
+	}
+	return view
+}
+
+// feedSpectators hands a spectator view to the spectators, held back by the
+// room's spectator delay. The start of a game gives nothing away and the end
+// of one makes the delay pointless, so those are let straight through.
+func (r *Room) feedSpectators(view GameState) {
+	r.feed = append(r.feed, view)
+	delay := r.settings.SpectatorDelay
+	if view.Turn == 0 || view.GameOver {
+		delay = 0
+	}
+	for len(r.feed) > delay {
+		released := r.feed[0]
+		r.released = &released
+		r.feed = r.feed[1:]
+		for client, id := range r.clients {
+			if r.spectating(client, id) {
+				emitGameState(*r.released, client)
+			}
+		}
+	}
+	if view.GameOver {
+		r.feed, r.released = nil, nil
+	}
+}
+
+// welcomeSpectator sends a spectator who just arrived the latest view they may
+// see.
+func (r *Room) welcomeSpectator(c *Client) {
+	view := r.spectatorView(engine.Result{}, "", false)
+	if r.settings.SpectatorDelay > 0 && r.released != nil {
+		view = *r.released
+		view.Spectators = r.spectatorCount()
+	}
+	emitGameState(view, c)
+}
+
+// emitGameState sends a game state to c.
+func emitGameState(gs GameState, c *Client) {
+	data, err := json.Marshal(gs)
+	if err != nil {
+		log.Printf("Failed to marshal game state: %v", err)
+		return
+	}
+	emit(Event{
+		Type:    "GAME_ACTION_RESULT",
+		Payload: data,
+	}, c)
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// waitForState reads game states until one matching ok arrives.
+func waitForState(t *testing.T, received chan Event, ok func(GameState) bool) GameState {
+	t.Helper()
+	for {
+		var gs GameState
+		if err := json.Unmarshal(waitFor(t, received, "GAME_ACTION_RESULT").Payload, &gs); err != nil {
+			t.Fatalf("failed to unmarshal game state: %v", err)
+		}
+		if ok(gs) {
+			return gs
+		}
+	}
+}
+
+func TestSpectatorView(t *testing.T) {
+	h := NewHub()
+	h.setDisplayName("p1", "Alice")
+	h.setDisplayName("p2", "Bob")
+	c1, r1 := newTestClient(h, "p1")
+	c2, _ := newTestClient(h, "p2")
+	watcher, rw := newTestClient(h, "p3")
+	late, rl := newTestClient(h, "p4")
+
+	send(t, watcher, EventJoinRoom, JoinRoomEvent{Room: "arena", Spectate: true})
+	expectError(t, rw, CodeRoomNotFound, EventJoinRoom)
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	// Spectating takes no seat, even with one free
+	if err := send(t, watcher, EventJoinRoom, JoinRoomEvent{Room: "arena", Spectate: true}); err != nil {
+		t.Fatalf("Failed to spectate: %v", err)
+	}
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	send(t, late, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+
+	gs := waitForState(t, rl, func(GameState) bool { return true })
+	if !gs.Spectator || gs.Spectators != 2 {
+		t.Errorf("Expected a spectator view with 2 spectators, got %+v", gs)
+	}
+	if gs.PlayerStates["player1"].Name != "Alice" || gs.PlayerStates["player2"].Name != "Bob" {
+		t.Errorf("Expected Alice and Bob as player 1 and 2, got %+v", gs.PlayerStates)
+	}
+	if _, ok := gs.PlayerStates["you"]; ok {
+		t.Errorf("Expected no you in a spectator view, got %+v", gs.PlayerStates)
+	}
+
+	var count struct{ Spectators int }
+	for count.Spectators != 2 {
+		json.Unmarshal(waitFor(t, r1, "SPECTATOR_COUNT").Payload, &count)
+	}
+
+	send(t, watcher, EventGameAction, map[string]string{"room": "arena", "action": "WAIT"})
+	expectError(t, rw, CodeNotSeated, EventGameAction)
+
+	send(t, late, EventLeaveRoom, nil)
+	for count.Spectators != 1 {
+		json.Unmarshal(waitFor(t, r1, "SPECTATOR_COUNT").Payload, &count)
+	}
+}
+
+func TestSpectatorDelay(t *testing.T) {
+	h := NewHub()
+	c1, r1 := newTestClient(h, "p1")
+	c2, _ := newTestClient(h, "p2")
+	watcher, rw := newTestClient(h, "p3")
+
+	settings := &RoomSettings{SpectatorDelay: 1}
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: "arena", Settings: settings})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	send(t, watcher, EventJoinRoom, JoinRoomEvent{Room: "arena"})
+	if gs := waitForState(t, rw, func(GameState) bool { return true }); gs.Turn != 0 {
+		t.Fatalf("Expected the spectator to start at turn 0, got %d", gs.Turn)
+	}
+
+	for turn := 1; turn <= 2; turn++ {
+		send(t, c1, EventGameAction, map[string]string{"room": "arena", "action": "WAIT"})
+		send(t, c2, EventGameAction, map[string]string{"room": "arena", "action": "WAIT"})
+		waitForState(t, r1, func(gs GameState) bool { return gs.Turn == turn })
+		for turn == 1 && len(rw) > 0 {
+			if event := <-rw; event.Type == "GAME_ACTION_RESULT" {
+				t.Fatalf("Expected the spectator to see nothing of turn 1 before turn 2")
+			}
+		}
+	}
+	gs := waitForState(t, rw, func(GameState) bool { return true })
+	if gs.Turn != 1 || gs.PlayerStates["player1"].Action != "WAIT" {
+		t.Errorf("Expected the spectator to see turn 1 after turn 2, got turn %d", gs.Turn)
+	}
+
+	send(t, c2, EventLeaveRoom, nil)
+	gs = waitForState(t, rw, func(gs GameState) bool { return gs.GameOver })
+	if gs.Winner != "p1 wins by forfeit!" {
+		t.Errorf("Expected the spectator to see p1 win by forfeit, got %q", gs.Winner)
+	}
+}
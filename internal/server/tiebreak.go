@@ -0,0 +1,66 @@
+package server
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"prisoner-fencing/internal/engine"
+)
+
+// Tie-break policies for a square both players advance into in the same turn.
+const (
+	TieBreakSubmission = "submission" // whoever chose their action first, as in the rules
+	TieBreakPlayer1    = "player1"
+	TieBreakCoinFlip   = "coinflip"
+	TieBreakNone       = "none" // nobody moves
+)
+
+// tieBreakNames are how the policies are written in the turn log.
+var tieBreakNames = map[string]string{
+	TieBreakSubmission: "submission order",
+	TieBreakPlayer1:    "player 1",
+	TieBreakCoinFlip:   "coin flip",
+	TieBreakNone:       "nobody moves",
+}
+
+// validTieBreak returns the policy to use for the requested one, which
+// defaults to submission order.
+func validTieBreak(policy string) (string, error) {
+	if policy == "" {
+		return TieBreakSubmission, nil
+	}
+	if _, ok := tieBreakNames[policy]; !ok {
+		return "", fmt.Errorf("unknown tie-break policy: %s", policy)
+	}
+	return policy, nil
+}
+
+// newTieBreakRand returns the coin used by the coin flip policy. A zero seed
+// picks one from the clock.
+func newTieBreakRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// priority decides who takes a contested square this turn under the room's
+// tie-break policy.
+func (r *Room) priority(ids [2]string) engine.Priority {
+	switch r.settings.TieBreak {
+	case TieBreakPlayer1:
+		return engine.PriorityPlayer1
+	case TieBreakCoinFlip:
+		return engine.Priority(r.rng.Intn(2))
+	case TieBreakNone:
+		return engine.PriorityNone
+	}
+	// Submission order; player 1 wins if the times cannot tell them apart
+	t1 := r.state.PlayerStates[ids[0]].submittedAt
+	t2 := r.state.PlayerStates[ids[1]].submittedAt
+	if t2.Before(t1) {
+		return engine.PriorityPlayer2
+	}
+	return engine.PriorityPlayer1
+}
@@ -0,0 +1,696 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"prisoner-fencing/internal/tournament"
+)
+
+// A signed in player creates a tournament over HTTP, other players enter it,
+// and its organizer starts it once enough have. Entrants are seeded by their
+// rating. Every match of the bracket that is ready to play gets a room kept
+// for its two players, who are sent tournament_match to join it. Once the
+// room's series is decided the result is read back from the database and the
+// bracket moves on, opening rooms for the matches that became ready. An
+// elimination match that ends in a draw is played again in the same room.
+// Players who do not sit down by the match's join deadline forfeit it.
+// Clients watching a tournament with tournament_watch are sent
+// tournament_update whenever it changes.
+
+// tournamentRoomPrefix starts the name of every tournament match room, which
+// is followed by the tournament id and the match id. Joining one that does not
+// exist only creates it for a match waiting to be played.
+const tournamentRoomPrefix = "tournament-"
+
+// What a tournament is doing.
+const (
+	TournamentRegistering = "registering" // taking entrants
+	TournamentRunning     = "running"
+	TournamentFinished    = "finished"
+)
+
+// maxEntrants caps how many players can enter a tournament.
+const maxEntrants = 64
+
+// tournamentJoinTimeout is how long both players of a tournament match have
+// to sit down in its room before whoever has not forfeits it.
+const tournamentJoinTimeout = 5 * time.Minute
+
+var (
+	errTournamentNotFound = errors.New("tournament not found")
+	errTournamentStarted  = errors.New("tournament has already started")
+	errTournamentFull     = errors.New("tournament is full")
+	errAlreadyEntered     = errors.New("player has already entered")
+	errNotOrganizer       = errors.New("only the organizer can start the tournament")
+)
+
+// TournamentRequest is the body of a request to create a tournament.
+type TournamentRequest struct {
+	Name    string            `json:"name"`
+	Format  tournament.Format `json:"format"`
+	Rounds  int               `json:"rounds,omitempty"` // of a Swiss tournament, 0 picks enough for a clear winner
+	Ruleset string            `json:"ruleset,omitempty"`
+	BestOf  int               `json:"bestOf,omitempty"` // games in each match's series
+}
+
+// Entrant is a player entered in a tournament.
+type Entrant struct {
+	Player string `json:"player"`
+	Name   string `json:"name"`   // display name
+	Rating int    `json:"rating"` // when they entered, which seeds them
+}
+
+// TournamentInfo describes a tournament. The tournament list leaves out its
+// bracket.
+type TournamentInfo struct {
+	ID        string                 `json:"id"`
+	Name      string                 `json:"name"`
+	Format    tournament.Format      `json:"format"`
+	Rounds    int                    `json:"rounds,omitempty"`
+	Ruleset   string                 `json:"ruleset"`
+	BestOf    int                    `json:"bestOf"`
+	Organizer string                 `json:"organizer"` // player id of whoever created it
+	Created   time.Time              `json:"created"`
+	Status    string                 `json:"status"`
+	Entrants  []Entrant              `json:"entrants"` // in seed order once started
+	Bracket   *tournament.Tournament `json:"bracket,omitempty"`
+	Standings []tournament.Standing  `json:"standings,omitempty"` // of a Swiss tournament
+	Rooms     map[int]string         `json:"rooms,omitempty"`     // match id -> room of every match waiting to be played
+}
+
+// TournamentMatchEvent tells a player their next tournament match is ready
+// to be played in Room.
+type TournamentMatchEvent struct {
+	Tournament string `json:"tournament"`
+	Match      int    `json:"match"`
+	Room       string `json:"room"`
+	Opponent   string `json:"opponent"` // player id
+	Name       string `json:"name"`     // display name of the opponent
+	// Replay is set when the match was drawn and has to be played again.
+	Replay bool `json:"replay,omitempty"`
+}
+
+// tournamentEntry is a tournament and what it needs to run its matches.
+type tournamentEntry struct {
+	info     TournamentInfo // Bracket, Standings and Rooms are filled in by describe
+	settings RoomSettings   // of every match room
+	bracket  *tournament.Tournament
+	joinBy   map[int]time.Time // match id -> when its players forfeit if absent
+}
+
+// tournamentResult is how a tournament match room's series ended.
+type tournamentResult struct {
+	winner string // player id, "" for a draw
+	series int64  // id of the stored series, 0 if it was not stored
+	match  int64  // id of the last stored game, 0 if it was not stored
+}
+
+// tournaments keeps the hub's tournaments.
+type tournaments struct {
+	hub *Hub
+	sync.Mutex
+	byID        map[string]*tournamentEntry
+	watchers    map[*Client]string // client -> id of the tournament they watch
+	joinTimeout time.Duration      // tournamentJoinTimeout, shorter in tests
+}
+
+func newTournaments(h *Hub) *tournaments {
+	return &tournaments{
+		hub:         h,
+		byID:        make(map[string]*tournamentEntry),
+		watchers:    make(map[*Client]string),
+		joinTimeout: tournamentJoinTimeout,
+	}
+}
+
+// create makes a tournament organized by player id, taking entrants.
+func (m *tournaments) create(id string, req TournamentRequest) (TournamentInfo, error) {
+	switch req.Format {
+	case tournament.SingleElimination, tournament.DoubleElimination:
+		req.Rounds = 0
+	case tournament.Swiss:
+		if req.Rounds < 0 {
+			return TournamentInfo{}, fmt.Errorf("rounds cannot be negative")
+		}
+	default:
+		return TournamentInfo{}, fmt.Errorf("unknown tournament format: %s", req.Format)
+	}
+	if req.Name = strings.TrimSpace(req.Name); req.Name == "" {
+		return TournamentInfo{}, fmt.Errorf("a tournament needs a name")
+	}
+	settings := m.hub.defaultSettings
+	settings.Ruleset, settings.BestOf = req.Ruleset, req.BestOf
+	if err := settings.normalize(m.hub); err != nil {
+		return TournamentInfo{}, err
+	}
+
+	e := &tournamentEntry{
+		info: TournamentInfo{
+			ID:        randomHex(8),
+			Name:      req.Name,
+			Format:    req.Format,
+			Rounds:    req.Rounds,
+			Ruleset:   settings.Ruleset,
+			BestOf:    settings.BestOf,
+			Organizer: id,
+			Created:   time.Now(),
+			Status:    TournamentRegistering,
+			Entrants:  []Entrant{},
+		},
+		settings: settings,
+		joinBy:   make(map[int]time.Time),
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.byID[e.info.ID] = e
+	return e.describe(false), nil
+}
+
+// list returns every tournament without its bracket, oldest first.
+func (m *tournaments) list() []TournamentInfo {
+	m.Lock()
+	defer m.Unlock()
+	infos := make([]TournamentInfo, 0, len(m.byID))
+	for _, e := range m.byID {
+		infos = append(infos, e.describe(false))
+	}
+	slices.SortFunc(infos, func(a, b TournamentInfo) int { return a.Created.Compare(b.Created) })
+	return infos
+}
+
+// get returns tournament tid in full, as JSON since its bracket keeps
+// changing.
+func (m *tournaments) get(tid string) (json.RawMessage, error) {
+	m.Lock()
+	defer m.Unlock()
+	e, ok := m.byID[tid]
+	if !ok {
+		return nil, errTournamentNotFound
+	}
+	return json.Marshal(e.describe(true))
+}
+
+// enter puts player id in tournament tid.
+func (m *tournaments) enter(tid, id string) (TournamentInfo, error) {
+	entrant := Entrant{Player: id, Name: m.hub.displayName(id), Rating: m.hub.rating(id)}
+
+	m.Lock()
+	e, ok := m.byID[tid]
+	if !ok {
+		m.Unlock()
+		return TournamentInfo{}, errTournamentNotFound
+	}
+	var err error
+	switch {
+	case e.info.Status != TournamentRegistering:
+		err = errTournamentStarted
+	case slices.ContainsFunc(e.info.Entrants, func(other Entrant) bool { return other.Player == id }):
+		err = errAlreadyEntered
+	case len(e.info.Entrants) >= maxEntrants:
+		err = errTournamentFull
+	}
+	if err != nil {
+		m.Unlock()
+		return TournamentInfo{}, err
+	}
+	e.info.Entrants = append(e.info.Entrants, entrant)
+	info := e.describe(false)
+	m.Unlock()
+
+	m.update(tid)
+	return info, nil
+}
+
+// start generates the bracket of tournament tid, which player id organizes,
+// and opens the rooms of its first matches.
+func (m *tournaments) start(tid, id string) (TournamentInfo, error) {
+	m.Lock()
+	e, ok := m.byID[tid]
+	if !ok {
+		m.Unlock()
+		return TournamentInfo{}, errTournamentNotFound
+	}
+	if e.info.Organizer != id {
+		m.Unlock()
+		return TournamentInfo{}, errNotOrganizer
+	}
+	if e.info.Status != TournamentRegistering {
+		m.Unlock()
+		return TournamentInfo{}, errTournamentStarted
+	}
+
+	// The best rated player is the top seed, then whoever entered first
+	slices.SortStableFunc(e.info.Entrants, func(a, b Entrant) int { return b.Rating - a.Rating })
+	players := make([]string, len(e.info.Entrants))
+	for i, entrant := range e.info.Entrants {
+		players[i] = entrant.Player
+	}
+	// Running already keeps out entrants while the first round is paired
+	// without the lock
+	format, rounds := e.info.Format, e.info.Rounds
+	e.info.Status = TournamentRunning
+	m.Unlock()
+
+	bracket, err := tournament.New(format, players, rounds)
+	m.Lock()
+	if err != nil {
+		e.info.Status = TournamentRegistering
+		m.Unlock()
+		return TournamentInfo{}, err
+	}
+	e.bracket = bracket
+	e.info.Rounds = bracket.Rounds
+	opened := m.matches(e, bracket.Ready(), false)
+	info := e.describe(false)
+	m.Unlock()
+
+	m.open(opened)
+	m.update(tid)
+	return info, nil
+}
+
+// report advances tournament tid with the result of its match mid.
+func (m *tournaments) report(tid string, mid int, result tournamentResult) {
+	winner := m.winner(result)
+
+	m.Lock()
+	e, ok := m.byID[tid]
+	if !ok || e.bracket == nil {
+		m.Unlock()
+		return
+	}
+	ready, err := e.bracket.Report(mid, winner)
+	var opened []matchCall
+	// Watchers hear of a result, and of a draw to be played again
+	changed := true
+	switch {
+	case errors.Is(err, tournament.ErrDraw):
+		match, _ := e.bracket.Match(mid)
+		opened = m.matches(e, []*tournament.Match{match}, true)
+	case err != nil:
+		log.Printf("Failed to report match %d of tournament %s: %v", mid, tid, err)
+		changed = false
+	default:
+		opened = m.matches(e, ready, false)
+		if e.bracket.Over() {
+			e.info.Status = TournamentFinished
+		}
+	}
+	round := e.bracket.NextRound()
+	m.Unlock()
+
+	if round != nil {
+		// The last match of a Swiss round is in, and pairing the next can
+		// take a while
+		round.Pair()
+		m.Lock()
+		paired, pairErr := e.bracket.AddRound(round)
+		if pairErr != nil {
+			log.Printf("Failed to pair round of tournament %s: %v", tid, pairErr)
+		} else {
+			opened = append(opened, m.matches(e, paired, false)...)
+		}
+		m.Unlock()
+	}
+	m.open(opened)
+	if changed {
+		m.update(tid)
+	}
+}
+
+// winner returns the winner of a tournament match, as stored in the database
+// when it was.
+func (m *tournaments) winner(result tournamentResult) string {
+	db := m.hub.db
+	if db == nil || result.series == 0 && result.match == 0 {
+		return result.winner
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+	defer cancel()
+
+	if result.series != 0 {
+		series, err := db.GetSeries(ctx, result.series)
+		if err != nil {
+			log.Printf("Failed to get series %d: %v", result.series, err)
+			return result.winner
+		}
+		if series.Winner == 0 {
+			return ""
+		}
+		return series.Players[series.Winner-1]
+	}
+	match, err := db.GetMatch(ctx, result.match)
+	if err != nil {
+		log.Printf("Failed to get match %d: %v", result.match, err)
+		return result.winner
+	}
+	for _, p := range match.Participants {
+		if p.Seat == match.Winner {
+			return p.PlayerId
+		}
+	}
+	return ""
+}
+
+// matches returns the calls telling the players of matches of e where to
+// play them. A match called for the first time starts its join deadline. The
+// caller must hold the lock.
+func (m *tournaments) matches(e *tournamentEntry, matches []*tournament.Match, replay bool) []matchCall {
+	names := make(map[string]string)
+	for _, entrant := range e.info.Entrants {
+		names[entrant.Player] = entrant.Name
+	}
+	var calls []matchCall
+	for _, match := range matches {
+		if _, ok := e.joinBy[match.ID]; !ok {
+			e.joinBy[match.ID] = time.Now().Add(m.joinTimeout)
+			tid, mid := e.info.ID, match.ID
+			time.AfterFunc(m.joinTimeout, func() { m.noShow(tid, mid) })
+		}
+		settings := e.settings
+		settings.Visibility = VisibilityPrivate
+		settings.players = match.Players
+		settings.tournamentId, settings.pairing = e.info.ID, match.ID
+		settings.replayDraws = e.info.Format != tournament.Swiss
+		settings.joinBy = e.joinBy[match.ID]
+		for i, player := range match.Players {
+			opponent := match.Players[1-i]
+			calls = append(calls, matchCall{player: player, settings: settings, event: TournamentMatchEvent{
+				Tournament: e.info.ID,
+				Match:      match.ID,
+				Room:       tournamentRoom(e.info.ID, match.ID),
+				Opponent:   opponent,
+				Name:       names[opponent],
+				Replay:     replay,
+			}})
+		}
+	}
+	return calls
+}
+
+// matchCall tells player where to play a tournament match.
+type matchCall struct {
+	player   string
+	settings RoomSettings // of the match's room
+	event    TournamentMatchEvent
+}
+
+// open creates the rooms of the matches calls are for, and sends the calls
+// to the players' clients.
+func (m *tournaments) open(calls []matchCall) {
+	for _, call := range calls {
+		m.hub.room(call.event.Room, call.settings)
+		data, err := json.Marshal(call.event)
+		if err != nil {
+			log.Printf("Failed to marshal tournament match event: %v", err)
+			continue
+		}
+		m.hub.playerEmit(call.player, Event{Type: EventTournamentMatch, Payload: data})
+	}
+}
+
+// playerEmit sends an event to every client of player id, after letting go
+// of the lock as lobbyEmit does.
+func (h *Hub) playerEmit(id string, event Event) {
+	h.RLock()
+	var clients []*Client
+	for client := range h.client {
+		if client.id == id {
+			clients = append(clients, client)
+		}
+	}
+	h.RUnlock()
+
+	for _, client := range clients {
+		emit(event, client)
+	}
+}
+
+// roomSettings returns the settings of the room named name if it is the room
+// of a tournament match waiting to be played.
+func (m *tournaments) roomSettings(name string) (RoomSettings, bool) {
+	rest, ok := strings.CutPrefix(name, tournamentRoomPrefix)
+	if !ok {
+		return RoomSettings{}, false
+	}
+	tid, match, ok := strings.Cut(rest, "-")
+	mid, err := strconv.Atoi(match)
+	if !ok || err != nil {
+		return RoomSettings{}, false
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	e, ok := m.byID[tid]
+	if !ok || e.bracket == nil {
+		return RoomSettings{}, false
+	}
+	for _, ready := range e.bracket.Ready() {
+		if ready.ID == mid {
+			return m.matches(e, []*tournament.Match{ready}, false)[0].settings, true
+		}
+	}
+	return RoomSettings{}, false
+}
+
+// noShow settles match mid of tournament tid once its join deadline has
+// passed, if it is still waiting for its players. The room does that for
+// whoever turned up; with no room, nobody did.
+func (m *tournaments) noShow(tid string, mid int) {
+	name := tournamentRoom(tid, mid)
+	settings, ok := m.roomSettings(name)
+	if !ok {
+		return
+	}
+	if r, ok := m.hub.findRoom(name); ok && r.send(roomCommand{kind: commandTick}) == nil {
+		return
+	}
+	m.report(tid, mid, tournamentResult{winner: noShowWinner(settings, "")})
+}
+
+// forfeitNoShow settles the tournament match the room is kept for if its
+// players have not both sat down by its join deadline. The player who has
+// goes through.
+func (r *Room) forfeitNoShow(now time.Time) {
+	if r.settings.tournamentId == "" || !r.awaitingMatch() || now.Before(r.settings.joinBy) {
+		return
+	}
+	seated := ""
+	if r.state != nil {
+		ids, _ := r.state.seats()
+		seated = ids[0] + ids[1]
+	}
+	r.calledOff = true
+	r.emit(Event{
+		Type:    EventMatchCancelled,
+		Payload: json.RawMessage(fmt.Sprintf(`{"room": "%s", "status": "Opponent did not join, the match is forfeited"}`, r.name)),
+	})
+	result := tournamentResult{winner: noShowWinner(r.settings, seated)}
+	go r.hub.tournaments.report(r.settings.tournamentId, r.settings.pairing, result)
+}
+
+// noShowWinner returns who goes through a tournament match only player
+// seated, "" for nobody, turned up to. If neither did, an elimination match
+// goes to its first seat and a Swiss match is drawn.
+func noShowWinner(settings RoomSettings, seated string) string {
+	if seated == "" && settings.replayDraws {
+		return settings.players[0]
+	}
+	return seated
+}
+
+// tournamentRoom returns the name of the room of match mid of tournament tid.
+func tournamentRoom(tid string, mid int) string {
+	return fmt.Sprintf("%s%s-%d", tournamentRoomPrefix, tid, mid)
+}
+
+// describe returns the tournament as it is now, with its bracket if full is
+// set. The caller must hold the lock, and the bracket may only be marshalled
+// under it.
+func (e *tournamentEntry) describe(full bool) TournamentInfo {
+	info := e.info
+	info.Entrants = slices.Clone(e.info.Entrants)
+	if !full || e.bracket == nil {
+		return info
+	}
+	info.Bracket = e.bracket
+	if e.bracket.Format == tournament.Swiss {
+		info.Standings = e.bracket.Standings()
+	}
+	info.Rooms = make(map[int]string)
+	for _, match := range e.bracket.Ready() {
+		info.Rooms[match.ID] = tournamentRoom(e.info.ID, match.ID)
+	}
+	return info
+}
+
+func TournamentWatchHandler(event Event, c *Client) error {
+	var payload struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return handlerError(CodeBadRequest, "failed to unmarshal tournament watch: %v", err)
+	}
+	// An empty id stops watching
+	if payload.ID == "" {
+		c.hub.tournaments.unwatch(c)
+		return ack(event, c)
+	}
+	data, err := c.hub.tournaments.watch(c, payload.ID)
+	if err != nil {
+		return handlerError(CodeTournamentNotFound, "tournament not found: %s", payload.ID)
+	}
+	emit(Event{Type: EventTournamentUpdate, Payload: data, ID: event.ID}, c)
+	return nil
+}
+
+// watch sends client c every update of tournament tid from now on, in place
+// of the one it watched before, and returns the tournament as it is now.
+func (m *tournaments) watch(c *Client, tid string) (json.RawMessage, error) {
+	m.Lock()
+	defer m.Unlock()
+	e, ok := m.byID[tid]
+	if !ok {
+		return nil, errTournamentNotFound
+	}
+	m.watchers[c] = tid
+	return json.Marshal(e.describe(true))
+}
+
+// unwatch stops sending client c tournament updates.
+func (m *tournaments) unwatch(c *Client) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.watchers, c)
+}
+
+// update sends tournament tid as it is now to the clients watching it.
+func (m *tournaments) update(tid string) {
+	m.Lock()
+	e, ok := m.byID[tid]
+	var watchers []*Client
+	for c, watched := range m.watchers {
+		if watched == tid {
+			watchers = append(watchers, c)
+		}
+	}
+	if !ok || len(watchers) == 0 {
+		m.Unlock()
+		return
+	}
+	data, err := json.Marshal(e.describe(true))
+	m.Unlock()
+	if err != nil {
+		log.Printf("Failed to marshal tournament %s: %v", tid, err)
+		return
+	}
+
+	for _, c := range watchers {
+		emit(Event{Type: EventTournamentUpdate, Payload: data}, c)
+	}
+}
+
+// reportTournament hands the result of the series just decided in a
+// tournament match room to its tournament. series is the id it was stored
+// under, 0 if it was not.
+func (r *Room) reportTournament(s *series, stored int64) {
+	result := tournamentResult{series: stored}
+	if w := s.winner(); w != 0 {
+		result.winner = s.players[w-1]
+	}
+	if len(s.matches) > 0 {
+		result.match = s.matches[len(s.matches)-1]
+	}
+	// The tournament opens rooms and tells players, which the room must not
+	// wait on
+	go r.hub.tournaments.report(r.settings.tournamentId, r.settings.pairing, result)
+}
+
+func (s *Server) tournamentsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.hub.tournaments.list())
+}
+
+func (s *Server) tournamentHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := s.hub.tournaments.get(r.PathValue("id"))
+	if err != nil {
+		tournamentError(w, err)
+		return
+	}
+	writeJSON(w, data)
+}
+
+func (s *Server) createTournamentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := s.sessionPlayer(r)
+	if err != nil {
+		http.Error(w, "Invalid session", http.StatusUnauthorized)
+		return
+	}
+	var req TournamentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid tournament", http.StatusBadRequest)
+		return
+	}
+	info, err := s.hub.tournaments.create(id, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+func (s *Server) enterTournamentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := s.sessionPlayer(r)
+	if err != nil {
+		http.Error(w, "Invalid session", http.StatusUnauthorized)
+		return
+	}
+	info, err := s.hub.tournaments.enter(r.PathValue("id"), id)
+	if err != nil {
+		tournamentError(w, err)
+		return
+	}
+	writeJSON(w, info)
+}
+
+func (s *Server) startTournamentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := s.sessionPlayer(r)
+	if err != nil {
+		http.Error(w, "Invalid session", http.StatusUnauthorized)
+		return
+	}
+	info, err := s.hub.tournaments.start(r.PathValue("id"), id)
+	if err != nil {
+		tournamentError(w, err)
+		return
+	}
+	writeJSON(w, info)
+}
+
+// tournamentError writes the response to a tournament request that failed
+// with err.
+func tournamentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errTournamentNotFound):
+		http.Error(w, "Tournament not found", http.StatusNotFound)
+	case errors.Is(err, errNotOrganizer):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, errTournamentStarted), errors.Is(err, errTournamentFull), errors.Is(err, errAlreadyEntered):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
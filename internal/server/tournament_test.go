@@ -0,0 +1,323 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"prisoner-fencing/internal/database"
+	"prisoner-fencing/internal/engine"
+	"prisoner-fencing/internal/tournament"
+)
+
+// waitForTournament waits for a tournament update that satisfies ok.
+func waitForTournament(t *testing.T, received chan Event, ok func(TournamentInfo) bool) TournamentInfo {
+	t.Helper()
+	for {
+		var info TournamentInfo
+		if err := json.Unmarshal(waitFor(t, received, EventTournamentUpdate).Payload, &info); err != nil {
+			t.Fatalf("failed to unmarshal tournament: %v", err)
+		}
+		if ok(info) {
+			return info
+		}
+	}
+}
+
+// waitForCall waits for a tournament_match event.
+func waitForCall(t *testing.T, received chan Event) TournamentMatchEvent {
+	t.Helper()
+	var call TournamentMatchEvent
+	if err := json.Unmarshal(waitFor(t, received, EventTournamentMatch).Payload, &call); err != nil {
+		t.Fatalf("failed to unmarshal tournament match: %v", err)
+	}
+	return call
+}
+
+// newTournament creates a tournament of the one turn ruleset organized by
+// the first of players, and enters them all in order.
+func newTournament(t *testing.T, h *Hub, format tournament.Format, players ...string) string {
+	t.Helper()
+	info, err := h.tournaments.create(players[0], TournamentRequest{Name: "Cup", Format: format, Ruleset: "short"})
+	if err != nil {
+		t.Fatalf("Failed to create tournament: %v", err)
+	}
+	for _, p := range players {
+		if _, err := h.tournaments.enter(info.ID, p); err != nil {
+			t.Fatalf("Failed to enter %s: %v", p, err)
+		}
+	}
+	return info.ID
+}
+
+func TestTournamentRoutes(t *testing.T) {
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	rulesets := map[string]engine.Ruleset{engine.DefaultRulesetName: engine.DefaultRuleset()}
+	s := &Server{db: db, sessions: newSessions("secret"), rulesets: rulesets}
+	server := httptest.NewServer(s.RegisterRoutes())
+	defer server.Close()
+
+	request := func(method, path, token, body string, v any) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+		defer resp.Body.Close()
+		if v != nil && resp.StatusCode < 300 {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatalf("error decoding response body. Err: %v", err)
+			}
+		}
+		return resp.StatusCode
+	}
+	p1 := s.sessions.issue("guest-1", time.Now())
+	p2 := s.sessions.issue("guest-2", time.Now())
+	p3 := s.sessions.issue("guest-3", time.Now())
+
+	req, _ := http.NewRequest("POST", server.URL+"/tournaments", strings.NewReader(`{"name": "Cup", "format": "swiss"}`))
+	req.Header.Set("Authorization", "Bearer "+p1)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected the tournament to be created; got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected a JSON response; got Content-Type %q", ct)
+	}
+	var created TournamentInfo
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("error decoding response body. Err: %v", err)
+	}
+	path := "/tournaments/" + created.ID
+	tests := []struct {
+		method, path, token, body string
+		status                    int
+	}{
+		{"POST", "/tournaments", "", `{"name": "Cup", "format": "swiss"}`, http.StatusUnauthorized},
+		{"POST", "/tournaments", p1, `{"name": "Cup", "format": "knockout"}`, http.StatusBadRequest},
+		{"POST", "/tournaments", p1, `{"name": "Cup", "format": "single", "bestOf": 2}`, http.StatusBadRequest},
+		{"POST", path + "/entrants", p1, "", http.StatusOK},
+		{"POST", path + "/entrants", p1, "", http.StatusConflict},
+		{"POST", path + "/start", p1, "", http.StatusBadRequest}, // one entrant is not a tournament
+		{"POST", path + "/entrants", p2, "", http.StatusOK},
+		{"POST", path + "/entrants", p3, "", http.StatusOK},
+		{"POST", path + "/start", p2, "", http.StatusForbidden},
+		{"POST", path + "/start", p1, "", http.StatusOK},
+		{"POST", path + "/start", p1, "", http.StatusConflict},
+		{"POST", "/tournaments/missing/entrants", p1, "", http.StatusNotFound},
+		{"GET", "/tournaments/missing", "", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if status := request(tt.method, tt.path, tt.token, tt.body, nil); status != tt.status {
+			t.Errorf("%s %s: expected status %d; got %d", tt.method, tt.path, tt.status, status)
+		}
+	}
+
+	var list []TournamentInfo
+	request("GET", "/tournaments", "", "", &list)
+	if len(list) != 1 || list[0].Status != TournamentRunning || len(list[0].Entrants) != 3 || list[0].Bracket != nil {
+		t.Errorf("expected the running tournament without its bracket; got %+v", list)
+	}
+	var info TournamentInfo
+	request("GET", path, "", "", &info)
+	if info.Rounds != 2 || info.Bracket == nil || len(info.Standings) != 3 || len(info.Rooms) != 1 {
+		t.Errorf("expected the first round of 2 with one match to play; got %+v", info)
+	}
+}
+
+func TestTournamentAdvancesWinners(t *testing.T) {
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	h := newSeriesHub()
+	h.db = db
+
+	c1, r1 := newTestClient(h, "p1")
+	c2, r2 := newTestClient(h, "p2")
+	c3, r3 := newTestClient(h, "p3")
+	watcher, rw := newTestClient(h, "p4")
+	id := newTournament(t, h, tournament.SingleElimination, "p1", "p2", "p3")
+
+	if err := send(t, watcher, EventTournamentWatch, map[string]string{"id": id}); err != nil {
+		t.Fatalf("Failed to watch the tournament: %v", err)
+	}
+	waitForTournament(t, rw, func(info TournamentInfo) bool { return info.Status == TournamentRegistering })
+	send(t, watcher, EventTournamentWatch, map[string]string{"id": "missing"})
+	expectError(t, rw, CodeTournamentNotFound, EventTournamentWatch)
+
+	if _, err := h.tournaments.start(id, "p1"); err != nil {
+		t.Fatalf("Failed to start the tournament: %v", err)
+	}
+	waitForTournament(t, rw, func(info TournamentInfo) bool { return info.Status == TournamentRunning })
+
+	// p1 has a bye, so p2 and p3 play first
+	semi := waitForCall(t, r2)
+	if call := waitForCall(t, r3); call.Room != semi.Room || semi.Opponent != "p3" || call.Opponent != "p2" {
+		t.Fatalf("Expected p2 and p3 called to one room, got %+v and %+v", semi, call)
+	}
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: semi.Room})
+	expectError(t, r1, CodeNoSeat, EventJoinRoom)
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: semi.Room})
+	send(t, c3, EventJoinRoom, JoinRoomEvent{Room: semi.Room})
+	playGame(t, c2, c3, r3, semi.Room)
+	send(t, c3, EventRematch, map[string]string{"room": semi.Room})
+	expectError(t, r3, CodeWrongPhase, EventRematch)
+	send(t, c3, EventLeaveRoom, nil)
+
+	final := waitForCall(t, r1)
+	if call := waitForCall(t, r2); call.Room != final.Room || final.Opponent != "p2" {
+		t.Fatalf("Expected p1 to meet p2 in the final, got %+v and %+v", final, call)
+	}
+	send(t, c2, EventLeaveRoom, nil)
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: final.Room})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: final.Room})
+	playGame(t, c1, c2, r2, final.Room)
+
+	info := waitForTournament(t, rw, func(info TournamentInfo) bool { return info.Status == TournamentFinished })
+	if info.Bracket.Champion != "p1" || len(info.Rooms) != 0 {
+		t.Errorf("Expected p1 to win the tournament, got %+v", info.Bracket)
+	}
+}
+
+func TestTournamentReplaysDraws(t *testing.T) {
+	h := newSeriesHub()
+	c1, r1 := newTestClient(h, "p1")
+	c2, r2 := newTestClient(h, "p2")
+	watcher, rw := newTestClient(h, "p3")
+	id := newTournament(t, h, tournament.DoubleElimination, "p1", "p2")
+	send(t, watcher, EventTournamentWatch, map[string]string{"id": id})
+	if _, err := h.tournaments.start(id, "p1"); err != nil {
+		t.Fatalf("Failed to start the tournament: %v", err)
+	}
+	waitForTournament(t, rw, func(info TournamentInfo) bool { return info.Status == TournamentRunning })
+	call := waitForCall(t, r1)
+	waitForCall(t, r2)
+
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: call.Room})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: call.Room})
+
+	send(t, c1, EventGameAction, map[string]string{"room": call.Room, "action": "WAIT"})
+	send(t, c2, EventGameAction, map[string]string{"room": call.Room, "action": "WAIT"})
+	gs := waitForState(t, r2, func(gs GameState) bool { return gs.GameOver })
+	if gs.Winner != "Draw!" {
+		t.Fatalf("Expected a draw, got %q", gs.Winner)
+	}
+	if replay := waitForCall(t, r1); !replay.Replay || replay.Room != call.Room {
+		t.Fatalf("Expected the match to be played again in %s, got %+v", call.Room, replay)
+	}
+	waitForTournament(t, rw, func(info TournamentInfo) bool { return info.Rooms[call.Match] == call.Room })
+
+	send(t, c1, EventRematch, map[string]string{"room": call.Room})
+	send(t, c2, EventRematch, map[string]string{"room": call.Room})
+	waitForState(t, r2, func(gs GameState) bool { return !gs.GameOver && len(gs.PlayerStates) == 2 })
+	playGame(t, c2, c1, r2, call.Room)
+
+	// p2 drops to the losers bracket side of the grand final, so they meet
+	// again
+	next := waitForCall(t, r1)
+	if next.Room == call.Room || next.Opponent != "p2" {
+		t.Errorf("Expected p1 and p2 to meet again in the grand final, got %+v", next)
+	}
+}
+
+func TestTournamentPairsSwissRounds(t *testing.T) {
+	h := newSeriesHub()
+	c1, r1 := newTestClient(h, "p1")
+	c2, r2 := newTestClient(h, "p2")
+	_, r3 := newTestClient(h, "p3")
+	id := newTournament(t, h, tournament.Swiss, "p1", "p2", "p3")
+	if _, err := h.tournaments.start(id, "p1"); err != nil {
+		t.Fatalf("Failed to start the tournament: %v", err)
+	}
+
+	// p3 has the first round's bye
+	call := waitForCall(t, r1)
+	waitForCall(t, r2)
+	send(t, c1, EventJoinRoom, JoinRoomEvent{Room: call.Room})
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: call.Room})
+	playGame(t, c1, c2, r2, call.Room)
+
+	// The second round is paired once the first is over, and p2 sits it out
+	next := waitForCall(t, r3)
+	if next.Opponent != "p1" || next.Room == call.Room {
+		t.Errorf("Expected p3 to meet p1 in the second round, got %+v", next)
+	}
+}
+
+func TestTournamentForfeitsNoShows(t *testing.T) {
+	h := newSeriesHub()
+	h.tournaments.joinTimeout = 50 * time.Millisecond
+	c2, r2 := newTestClient(h, "p2")
+	watcher, rw := newTestClient(h, "p4")
+	id := newTournament(t, h, tournament.SingleElimination, "p1", "p2", "p3")
+	send(t, watcher, EventTournamentWatch, map[string]string{"id": id})
+	if _, err := h.tournaments.start(id, "p1"); err != nil {
+		t.Fatalf("Failed to start the tournament: %v", err)
+	}
+
+	// p3 never sits down, so p2 goes through
+	semi := waitForCall(t, r2)
+	send(t, c2, EventJoinRoom, JoinRoomEvent{Room: semi.Room})
+	waitFor(t, r2, EventMatchCancelled)
+	send(t, c2, EventLeaveRoom, nil)
+	final := waitForCall(t, r2)
+	if final.Opponent != "p1" {
+		t.Fatalf("Expected p2 to meet p1 in the final, got %+v", final)
+	}
+
+	// Nobody turns up to the final, so the first seat goes through
+	info := waitForTournament(t, rw, func(info TournamentInfo) bool { return info.Status == TournamentFinished })
+	if info.Bracket.Champion != "p1" {
+		t.Errorf("Expected p1 to win the final nobody played, got %+v", info.Bracket)
+	}
+}
+
+func TestTournamentRoomReopens(t *testing.T) {
+	h := newSeriesHub()
+	h.idleTimeout = 20 * time.Millisecond
+	c1, r1 := newTestClient(h, "p1")
+	other, ro := newTestClient(h, "p3")
+	id := newTournament(t, h, tournament.SingleElimination, "p1", "p2")
+	if _, err := h.tournaments.start(id, "p1"); err != nil {
+		t.Fatalf("Failed to start the tournament: %v", err)
+	}
+	call := waitForCall(t, r1)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := h.findRoom(call.Room); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected room %s to close for being idle", call.Room)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The match is still to be played, so its room opens again for its players
+	if err := send(t, c1, EventJoinRoom, JoinRoomEvent{Room: call.Room}); err != nil {
+		t.Fatalf("Failed to join the reopened room: %v", err)
+	}
+	send(t, other, EventJoinRoom, JoinRoomEvent{Room: call.Room})
+	expectError(t, ro, CodeNoSeat, EventJoinRoom)
+	send(t, other, EventJoinRoom, JoinRoomEvent{Room: tournamentRoom(id, 2)})
+	expectError(t, ro, CodeRoomNotFound, EventJoinRoom)
+}
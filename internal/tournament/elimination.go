@@ -0,0 +1,147 @@
+package tournament
+
+// An elimination bracket is laid out in full when the tournament starts, with
+// every match knowing where its winner and loser go. The bracket has room for
+// the next power of two players, and the seats left over are byes against
+// the best seeds. In a double elimination tournament the losers of the
+// winners bracket drop into a losers bracket, whose winner meets the winners
+// bracket champion in the grand final. If the champion loses that, they have
+// lost once too and the final is played again.
+
+// buildElimination lays out the bracket and seats the players in the first
+// round.
+func (t *Tournament) buildElimination(double bool) {
+	k := log2(len(t.Players))
+	size := 1 << k
+
+	// winners[r] are the matches of round r of the winners bracket
+	winners := make([][]*Match, k+1)
+	for r := 1; r <= k; r++ {
+		for range size >> r {
+			winners[r] = append(winners[r], t.add(Winners, r))
+		}
+		for i, m := range winners[r-1] {
+			m.winnerTo = seat{winners[r][i/2], i % 2}
+		}
+	}
+
+	if double {
+		final := t.add(Final, 1)
+		winners[k][0].winnerTo = seat{final, 0}
+		if k == 1 {
+			winners[1][0].loserTo = seat{final, 1}
+		} else {
+			t.buildLosers(winners, size, final)
+		}
+	}
+
+	order := seedOrder(size)
+	for i, m := range winners[1] {
+		for j := range 2 {
+			player := ""
+			if s := order[2*i+j]; s <= len(t.Players) {
+				player = t.Players[s-1]
+			}
+			t.advance(seat{m, j}, player)
+		}
+	}
+}
+
+// buildLosers lays out the losers bracket under winners, the rounds of the
+// winners bracket of a tournament with room for size players. Its odd rounds
+// pair the players still in it, and its even rounds bring in the losers of
+// the next round of the winners bracket. The winner goes to final.
+func (t *Tournament) buildLosers(winners [][]*Match, size int, final *Match) {
+	k := len(winners) - 1
+	var previous []*Match
+	for r := 1; r <= 2*(k-1); r++ {
+		var round []*Match
+		for range size >> ((r+1)/2 + 1) {
+			round = append(round, t.add(Losers, r))
+		}
+		switch {
+		case r == 1:
+			for i, m := range winners[1] {
+				m.loserTo = seat{round[i/2], i % 2}
+			}
+		case r%2 == 0:
+			// Drop the losers in reverse order, so players do not meet again
+			// straight away
+			dropping := winners[r/2+1]
+			for i, m := range previous {
+				m.winnerTo = seat{round[i], 0}
+				dropping[len(dropping)-1-i].loserTo = seat{round[i], 1}
+			}
+		default:
+			for i, m := range previous {
+				m.winnerTo = seat{round[i/2], i % 2}
+			}
+		}
+		previous = round
+	}
+	previous[0].winnerTo = seat{final, 1}
+}
+
+// reportElimination records the winner of a played elimination match.
+func (t *Tournament) reportElimination(m *Match, winner string) {
+	m.Winner = winner
+	m.Done = true
+	t.decided(m)
+}
+
+// advance puts player, "" for a bye, in seat s. A match with a bye in it is
+// decided straight away.
+func (t *Tournament) advance(s seat, player string) {
+	m := s.match
+	if m == nil {
+		return
+	}
+	m.Players[s.index] = player
+	m.filled[s.index] = true
+	if !m.filled[0] || !m.filled[1] || (m.Players[0] != "" && m.Players[1] != "") {
+		return
+	}
+	m.Winner = m.Players[0]
+	if m.Winner == "" {
+		m.Winner = m.Players[1]
+	}
+	m.Done, m.Bye = true, true
+	t.decided(m)
+}
+
+// decided sends the winner and loser of a finished match on.
+func (t *Tournament) decided(m *Match) {
+	if m.Bracket == Final && m.Round == 1 && m.Winner == m.Players[1] && m.Players[0] != "" {
+		reset := t.add(Final, 2)
+		t.advance(seat{reset, 0}, m.Players[0])
+		t.advance(seat{reset, 1}, m.Players[1])
+		return
+	}
+	if m.winnerTo.match == nil {
+		t.Champion = m.Winner
+		return
+	}
+	t.advance(m.winnerTo, m.Winner)
+	t.advance(m.loserTo, m.loser())
+}
+
+// add appends a new match to the tournament.
+func (t *Tournament) add(bracket string, round int) *Match {
+	m := &Match{ID: len(t.Matches) + 1, Bracket: bracket, Round: round}
+	t.Matches = append(t.Matches, m)
+	return m
+}
+
+// seedOrder returns the seeds of a bracket for size players in the order
+// they are paired in the first round, so the best seeds meet last.
+func seedOrder(size int) []int {
+	order := []int{1}
+	for n := 1; n < size; n *= 2 {
+		next := make([]int, 0, 2*len(order))
+		for _, s := range order {
+			next = append(next, s, 2*n+1-s)
+		}
+		order = next
+	}
+	return order
+}
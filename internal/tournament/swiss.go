@@ -0,0 +1,203 @@
+package tournament
+
+import (
+	"fmt"
+	"slices"
+)
+
+// A Swiss tournament plays a fixed number of rounds, each paired once the
+// last one is over. Players on the same points meet where they can, and no
+// two players meet twice unless there is no other way to pair the round. The
+// player with the most points at the end wins, the better seed on a tie.
+
+// maxPairingSteps bounds the search for a round with no rematches. Among many
+// players who have met most of each other it could otherwise take
+// exponentially long, and then the round is paired greedily instead.
+const maxPairingSteps = 10000
+
+// Round is the next round of a Swiss tournament, to be paired apart from the
+// tournament so the search does not hold up whoever shares it.
+type Round struct {
+	number  int
+	matches int // in the tournament when the round was taken
+	bye     string
+	players []string // by standing, without the bye
+	met     map[[2]string]bool
+	pairs   [][2]string
+}
+
+// NextRound returns the round to pair once every match of the last one is
+// over, or nil if there is none. Pair it, then add it with AddRound.
+func (t *Tournament) NextRound() *Round {
+	if t.Format != Swiss || t.Over() {
+		return nil
+	}
+	round := 1
+	if n := len(t.Matches); n > 0 {
+		round = t.Matches[n-1].Round + 1
+	}
+	if round > t.Rounds {
+		return nil
+	}
+	for _, m := range t.Matches {
+		if !m.Done {
+			return nil
+		}
+	}
+
+	r := &Round{number: round, matches: len(t.Matches), met: make(map[[2]string]bool)}
+	for _, s := range t.Standings() {
+		r.players = append(r.players, s.Player)
+	}
+	// With an odd number of players the lowest ranked one who has not had a
+	// bye sits the round out, and scores a win for it
+	if len(r.players)%2 == 1 {
+		byes := make(map[string]bool)
+		for _, m := range t.Matches {
+			if m.Bye {
+				byes[m.Winner] = true
+			}
+		}
+		i := len(r.players) - 1
+		for i > 0 && byes[r.players[i]] {
+			i--
+		}
+		r.bye = r.players[i]
+		r.players = slices.Delete(r.players, i, i+1)
+	}
+	for _, m := range t.Matches {
+		r.met[m.Players] = true
+		r.met[[2]string{m.Players[1], m.Players[0]}] = true
+	}
+	return r
+}
+
+// Pair pairs the players of the round by their standings, without rematches
+// if it can find a way.
+func (r *Round) Pair() {
+	steps := maxPairingSteps
+	if r.pairs = pairUp(r.players, r.met, &steps); r.pairs == nil {
+		r.pairs = pairGreedy(r.players, r.met)
+	}
+}
+
+// AddRound adds the matches of a paired round to the tournament, and returns
+// them. It fails if the tournament has moved on since the round was taken.
+func (t *Tournament) AddRound(r *Round) ([]*Match, error) {
+	if len(t.Matches) != r.matches || r.pairs == nil {
+		return nil, fmt.Errorf("round %d is not the next round to play", r.number)
+	}
+	if r.bye != "" {
+		m := t.add(Rounds, r.number)
+		m.Players = [2]string{r.bye, ""}
+		m.filled = [2]bool{true, true}
+		m.Winner, m.Done, m.Bye = r.bye, true, true
+	}
+	var ready []*Match
+	for _, pair := range r.pairs {
+		m := t.add(Rounds, r.number)
+		m.Players = pair
+		m.filled = [2]bool{true, true}
+		ready = append(ready, m)
+	}
+	return ready, nil
+}
+
+// pairUp pairs each of players in order with the first one below them they
+// have not met that still lets the rest be paired. It returns nil if there is
+// no way to pair them all, or it has not found one in steps.
+func pairUp(players []string, met map[[2]string]bool, steps *int) [][2]string {
+	if len(players) == 0 {
+		return [][2]string{}
+	}
+	if *steps--; *steps < 0 {
+		return nil
+	}
+	for i := 1; i < len(players); i++ {
+		if met[[2]string{players[0], players[i]}] {
+			continue
+		}
+		rest := append(slices.Clone(players[1:i]), players[i+1:]...)
+		if pairs := pairUp(rest, met, steps); pairs != nil {
+			return append([][2]string{{players[0], players[i]}}, pairs...)
+		}
+	}
+	return nil
+}
+
+// pairGreedy pairs each of players in order with the first one below them
+// they have not met, or the next one below if they have met them all.
+func pairGreedy(players []string, met map[[2]string]bool) [][2]string {
+	players = slices.Clone(players)
+	var pairs [][2]string
+	for len(players) > 1 {
+		i := 1
+		for i < len(players)-1 && met[[2]string{players[0], players[i]}] {
+			i++
+		}
+		if met[[2]string{players[0], players[i]}] {
+			i = 1
+		}
+		pairs = append(pairs, [2]string{players[0], players[i]})
+		players = slices.Delete(players, i, i+1)[1:]
+	}
+	return pairs
+}
+
+// reportSwiss records the result of a played Swiss match, and crowns the
+// champion once every match of the last round is over. Other rounds are
+// paired with NextRound.
+func (t *Tournament) reportSwiss(m *Match, winner string) {
+	m.Winner = winner
+	m.Draw = winner == ""
+	m.Done = true
+	if m.Round < t.Rounds {
+		return
+	}
+	for _, other := range t.Matches {
+		if !other.Done {
+			return
+		}
+	}
+	t.Champion = t.Standings()[0].Player
+}
+
+// Standings returns every player's record, from the most points to the
+// fewest and by seed between players on the same points.
+func (t *Tournament) Standings() []Standing {
+	standings := make([]Standing, len(t.Players))
+	index := make(map[string]*Standing)
+	for i, p := range t.Players {
+		standings[i].Player = p
+		index[p] = &standings[i]
+	}
+	for _, m := range t.Matches {
+		if !m.Done {
+			continue
+		}
+		for _, p := range m.Players {
+			s, ok := index[p]
+			switch {
+			case !ok:
+			case m.Draw:
+				s.Draws++
+				s.Points += 0.5
+			case m.Winner == p:
+				s.Wins++
+				s.Points++
+			default:
+				s.Losses++
+			}
+		}
+	}
+	slices.SortStableFunc(standings, func(a, b Standing) int {
+		switch {
+		case a.Points > b.Points:
+			return -1
+		case a.Points < b.Points:
+			return 1
+		}
+		return 0
+	})
+	return standings
+}
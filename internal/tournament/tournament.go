@@ -0,0 +1,194 @@
+// Package tournament generates brackets for single elimination, double
+// elimination and Swiss tournaments, and advances players through them as
+// match results come in. It knows nothing about rooms or connections.
+package tournament
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Format is how a tournament pairs its players.
+type Format string
+
+const (
+	SingleElimination Format = "single"
+	DoubleElimination Format = "double"
+	Swiss             Format = "swiss"
+)
+
+// Brackets a match can be in.
+const (
+	Winners = "winners" // every elimination match of a single elimination tournament
+	Losers  = "losers"  // for players with one loss in a double elimination tournament
+	Final   = "final"   // the grand final of a double elimination tournament, and its reset
+	Rounds  = "rounds"  // every match of a Swiss tournament
+)
+
+// ErrDraw is returned when an elimination match is reported drawn. It has to
+// be played again.
+var ErrDraw = errors.New("elimination matches cannot be drawn")
+
+// Match is one pairing of the tournament.
+type Match struct {
+	ID      int       `json:"id"`
+	Bracket string    `json:"bracket"`
+	Round   int       `json:"round"`   // within its bracket, from 1
+	Players [2]string `json:"players"` // "" for a seat not decided yet, or a bye
+	Winner  string    `json:"winner,omitempty"`
+	Draw    bool      `json:"draw,omitempty"`
+	Done    bool      `json:"done"`
+	Bye     bool      `json:"bye,omitempty"` // decided without being played
+
+	filled   [2]bool // whether each seat is decided, a bye if its player is ""
+	winnerTo seat    // where the winner goes next
+	loserTo  seat    // where the loser goes next
+}
+
+// seat is a seat of a match a player advances to. A nil match is nowhere.
+type seat struct {
+	match *Match
+	index int
+}
+
+// Standing is a player's record in a Swiss tournament.
+type Standing struct {
+	Player string  `json:"player"`
+	Points float64 `json:"points"` // 1 for a win or bye, half for a draw
+	Wins   int     `json:"wins"`
+	Draws  int     `json:"draws"`
+	Losses int     `json:"losses"`
+}
+
+// Tournament is the bracket of a tournament and the results so far.
+type Tournament struct {
+	Format   Format   `json:"format"`
+	Players  []string `json:"players"` // in seed order
+	Rounds   int      `json:"rounds,omitempty"`
+	Matches  []*Match `json:"matches"`
+	Champion string   `json:"champion,omitempty"`
+}
+
+// New returns the bracket of a tournament between players, best seed first.
+// rounds is the number of rounds of a Swiss tournament, and 0 picks enough
+// to find a clear winner; elimination tournaments ignore it.
+func New(format Format, players []string, rounds int) (*Tournament, error) {
+	if len(players) < 2 {
+		return nil, fmt.Errorf("a tournament needs at least 2 players")
+	}
+	seen := make(map[string]bool)
+	for _, p := range players {
+		if p == "" || seen[p] {
+			return nil, fmt.Errorf("players must be distinct and not empty")
+		}
+		seen[p] = true
+	}
+
+	t := &Tournament{Format: format, Players: append([]string(nil), players...)}
+	switch format {
+	case SingleElimination:
+		t.buildElimination(false)
+	case DoubleElimination:
+		t.buildElimination(true)
+	case Swiss:
+		if rounds == 0 {
+			rounds = log2(len(players))
+		}
+		if rounds < 1 || rounds > len(players)-1 {
+			return nil, fmt.Errorf("a swiss tournament of %d players has 1 to %d rounds", len(players), len(players)-1)
+		}
+		t.Rounds = rounds
+		r := t.NextRound()
+		r.Pair()
+		t.AddRound(r)
+	default:
+		return nil, fmt.Errorf("unknown tournament format: %s", format)
+	}
+	return t, nil
+}
+
+// Ready returns the matches waiting to be played: both players are known and
+// there is no result yet.
+func (t *Tournament) Ready() []*Match {
+	var ready []*Match
+	for _, m := range t.Matches {
+		if m.ready() {
+			ready = append(ready, m)
+		}
+	}
+	return ready
+}
+
+// Match returns the match with the given id.
+func (t *Tournament) Match(id int) (*Match, bool) {
+	if id < 1 || id > len(t.Matches) {
+		return nil, false
+	}
+	return t.Matches[id-1], true
+}
+
+// Over reports whether the tournament has a champion.
+func (t *Tournament) Over() bool {
+	return t.Champion != ""
+}
+
+// Report records the result of a ready match: its winner, or "" for a draw.
+// Matches that become ready as a result are returned, except for the next
+// round of a Swiss tournament, which is paired with NextRound.
+func (t *Tournament) Report(id int, winner string) ([]*Match, error) {
+	m, ok := t.Match(id)
+	if !ok {
+		return nil, fmt.Errorf("no match %d", id)
+	}
+	if !m.ready() {
+		return nil, fmt.Errorf("match %d is not waiting for a result", id)
+	}
+	if winner != "" && winner != m.Players[0] && winner != m.Players[1] {
+		return nil, fmt.Errorf("%s does not play in match %d", winner, id)
+	}
+	if winner == "" && t.Format != Swiss {
+		return nil, ErrDraw
+	}
+
+	before := make(map[*Match]bool)
+	for _, r := range t.Ready() {
+		before[r] = true
+	}
+	if t.Format == Swiss {
+		t.reportSwiss(m, winner)
+	} else {
+		t.reportElimination(m, winner)
+	}
+	var ready []*Match
+	for _, r := range t.Ready() {
+		if !before[r] {
+			ready = append(ready, r)
+		}
+	}
+	return ready, nil
+}
+
+// ready reports whether the match is waiting to be played.
+func (m *Match) ready() bool {
+	return !m.Done && m.filled[0] && m.filled[1] && m.Players[0] != "" && m.Players[1] != ""
+}
+
+// loser returns the player who lost the decided match, "" for none.
+func (m *Match) loser() string {
+	switch m.Winner {
+	case m.Players[0]:
+		return m.Players[1]
+	case m.Players[1]:
+		return m.Players[0]
+	}
+	return ""
+}
+
+// log2 returns the number of halvings it takes to get n down to 1.
+func log2(n int) int {
+	k := 0
+	for size := 1; size < n; size *= 2 {
+		k++
+	}
+	return k
+}
@@ -0,0 +1,244 @@
+package tournament
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// players returns n player ids in seed order.
+func players(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("p%d", i+1)
+	}
+	return ids
+}
+
+// playOut reports every ready match won by the player pick chooses until the
+// tournament is over, and returns the number of matches played.
+func playOut(t *testing.T, tour *Tournament, pick func(m *Match) string) int {
+	t.Helper()
+	played := 0
+	for !tour.Over() {
+		ready := tour.Ready()
+		if len(ready) == 0 {
+			t.Fatalf("Expected a match to play before the tournament is over, got %+v", tour.Matches)
+		}
+		for _, m := range ready {
+			if _, err := tour.Report(m.ID, pick(m)); err != nil {
+				t.Fatalf("Failed to report match %d: %v", m.ID, err)
+			}
+			played++
+		}
+	}
+	return played
+}
+
+// better picks the better seed of a match.
+func better(tour *Tournament) func(m *Match) string {
+	return func(m *Match) string {
+		if slices.Index(tour.Players, m.Players[0]) < slices.Index(tour.Players, m.Players[1]) {
+			return m.Players[0]
+		}
+		return m.Players[1]
+	}
+}
+
+func TestByesGoToBestSeeds(t *testing.T) {
+	tour, err := New(SingleElimination, players(5), 0)
+	if err != nil {
+		t.Fatalf("Failed to create tournament: %v", err)
+	}
+	var pairings [][2]string
+	for _, m := range tour.Ready() {
+		pairings = append(pairings, m.Players)
+	}
+	expected := [][2]string{{"p4", "p5"}, {"p2", "p3"}}
+	if !slices.Equal(pairings, expected) {
+		t.Errorf("Expected pairings %v, got %v", expected, pairings)
+	}
+	for _, m := range tour.Matches[:4] {
+		if m.Bye != (m.Players[1] == "") {
+			t.Errorf("Expected only matches missing a player to be byes, got %+v", m)
+		}
+	}
+}
+
+func TestSingleElimination(t *testing.T) {
+	for n := 2; n <= 17; n++ {
+		tour, err := New(SingleElimination, players(n), 0)
+		if err != nil {
+			t.Fatalf("Failed to create tournament of %d: %v", n, err)
+		}
+		if played := playOut(t, tour, better(tour)); played != n-1 {
+			t.Errorf("Expected %d matches among %d players, got %d", n-1, n, played)
+		}
+		if tour.Champion != "p1" {
+			t.Errorf("Expected the top seed to win among %d players, got %s", n, tour.Champion)
+		}
+	}
+}
+
+func TestDoubleElimination(t *testing.T) {
+	for n := 2; n <= 17; n++ {
+		tour, err := New(DoubleElimination, players(n), 0)
+		if err != nil {
+			t.Fatalf("Failed to create tournament of %d: %v", n, err)
+		}
+		// Everyone but the champion loses twice
+		if played := playOut(t, tour, better(tour)); played != 2*(n-1) {
+			t.Errorf("Expected %d matches among %d players, got %d", 2*(n-1), n, played)
+		}
+		if tour.Champion != "p1" {
+			t.Errorf("Expected the top seed to win among %d players, got %s", n, tour.Champion)
+		}
+
+		// The runner up comes through the losers bracket and wins the reset
+		tour, _ = New(DoubleElimination, players(n), 0)
+		pick := better(tour)
+		upset := func(m *Match) string {
+			if m.Bracket == Final {
+				return m.Players[1]
+			}
+			return pick(m)
+		}
+		if played := playOut(t, tour, upset); played != 2*n-1 {
+			t.Errorf("Expected %d matches among %d players with a reset, got %d", 2*n-1, n, played)
+		}
+		last := tour.Matches[len(tour.Matches)-1]
+		if last.Bracket != Final || last.Round != 2 || tour.Champion != "p2" {
+			t.Errorf("Expected the champion to win the reset among %d players, got %+v", n, last)
+		}
+	}
+}
+
+func TestEliminationRejectsDraws(t *testing.T) {
+	tour, _ := New(SingleElimination, players(2), 0)
+	if _, err := tour.Report(1, ""); !errors.Is(err, ErrDraw) {
+		t.Errorf("Expected ErrDraw, got %v", err)
+	}
+	if _, err := tour.Report(1, "p3"); err == nil {
+		t.Errorf("Expected an error for a winner outside the match")
+	}
+	if _, err := tour.Report(1, "p2"); err != nil {
+		t.Fatalf("Failed to report match: %v", err)
+	}
+	if _, err := tour.Report(1, "p1"); err == nil {
+		t.Errorf("Expected an error reporting a finished match")
+	}
+	if tour.Champion != "p2" {
+		t.Errorf("Expected p2 to win, got %s", tour.Champion)
+	}
+}
+
+func TestSwiss(t *testing.T) {
+	tour, err := New(Swiss, players(5), 4)
+	if err != nil {
+		t.Fatalf("Failed to create tournament: %v", err)
+	}
+	met := make(map[[2]string]bool)
+	byes := make(map[string]bool)
+	rounds := 0
+	for !tour.Over() {
+		rounds++
+		seen := make(map[string]bool)
+		for _, m := range tour.Matches {
+			if m.Round != rounds {
+				continue
+			}
+			for _, p := range m.Players {
+				if p != "" && seen[p] {
+					t.Errorf("Expected %s to play once in round %d", p, rounds)
+				}
+				seen[p] = true
+			}
+			if m.Bye {
+				if byes[m.Winner] {
+					t.Errorf("Expected %s to have one bye", m.Winner)
+				}
+				byes[m.Winner] = true
+				continue
+			}
+			if met[m.Players] {
+				t.Errorf("Expected %v to meet once", m.Players)
+			}
+			met[m.Players], met[[2]string{m.Players[1], m.Players[0]}] = true, true
+
+			winner := better(tour)(m)
+			if m.Players == [2]string{"p2", "p3"} || m.Players == [2]string{"p3", "p2"} {
+				winner = ""
+			}
+			if _, err := tour.Report(m.ID, winner); err != nil {
+				t.Fatalf("Failed to report match %d: %v", m.ID, err)
+			}
+		}
+		if r := tour.NextRound(); r != nil {
+			r.Pair()
+			if _, err := tour.AddRound(r); err != nil {
+				t.Fatalf("Failed to add round %d: %v", rounds+1, err)
+			}
+		}
+	}
+
+	if rounds != 4 || tour.Champion != "p1" {
+		t.Errorf("Expected p1 to win after 4 rounds, got %s after %d", tour.Champion, rounds)
+	}
+	standings := tour.Standings()
+	if standings[0] != (Standing{Player: "p1", Points: 4, Wins: 4}) {
+		t.Errorf("Expected p1 to win every round, got %+v", standings[0])
+	}
+	for _, s := range standings {
+		if s.Wins+s.Draws+s.Losses != 4 {
+			t.Errorf("Expected a result every round for %s, got %+v", s.Player, s)
+		}
+	}
+}
+
+func TestSwissPairingIsBounded(t *testing.T) {
+	// The first 33 players have all met, so cannot all be paired without a
+	// rematch, which takes far too long to find out by trying every pairing
+	r := &Round{players: players(64), met: make(map[[2]string]bool)}
+	for _, a := range r.players[:33] {
+		for _, b := range r.players[:33] {
+			r.met[[2]string{a, b}] = true
+		}
+	}
+	r.Pair()
+
+	seen := make(map[string]bool)
+	rematches := 0
+	for _, pair := range r.pairs {
+		for _, p := range pair {
+			if seen[p] {
+				t.Errorf("Expected %s to be paired once", p)
+			}
+			seen[p] = true
+		}
+		if r.met[pair] {
+			rematches++
+		}
+	}
+	if len(seen) != 64 || rematches != 1 {
+		t.Errorf("Expected everyone paired with one rematch, got %v", r.pairs)
+	}
+}
+
+func TestNewRejectsBadTournaments(t *testing.T) {
+	tests := []struct {
+		format  Format
+		players []string
+		rounds  int
+	}{
+		{SingleElimination, players(1), 0},
+		{SingleElimination, []string{"p1", "p1"}, 0},
+		{Swiss, players(4), 4},
+		{"knockout", players(4), 0},
+	}
+	for _, tt := range tests {
+		if _, err := New(tt.format, tt.players, tt.rounds); err == nil {
+			t.Errorf("Expected an error for %s tournament of %v in %d rounds", tt.format, tt.players, tt.rounds)
+		}
+	}
+}